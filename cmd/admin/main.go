@@ -0,0 +1,92 @@
+// Command admin runs maintenance tasks against the database.
+//
+//	admin purge-user <idp-subject>
+//	admin save-template <analysis-id> <name>
+//	admin set-role <idp-subject> <user|teacher|admin>
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+)
+
+const usage = `usage: admin <command> [arguments]
+
+commands:
+  purge-user <idp-subject>              delete a user and all of their data
+  save-template <analysis-id> <name>    save an analysis's setup as a template for all users
+  set-role <idp-subject> <role>         make a user a user, teacher or admin
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	database.InitDB()
+	database.RunMigrations()
+
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "purge-user":
+		if len(os.Args) != 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+
+		if err := service.PurgeUserByIdpID(ctx, os.Args[2], "admin-cli"); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to purge user: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("purged user %s\n", os.Args[2])
+
+	case "save-template":
+		if len(os.Args) != 4 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+
+		analysisID, err := strconv.Atoi(os.Args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid analysis id %q\n", os.Args[2])
+			os.Exit(2)
+		}
+
+		template, err := service.CreateSharedTemplate(ctx, analysisID, os.Args[3])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to save template: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("saved template %d %q\n", template.ID, template.Name)
+
+	case "set-role":
+		if len(os.Args) != 4 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+
+		user, err := service.GetUserByIdpID(ctx, os.Args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to find user: %v\n", err)
+			os.Exit(1)
+		}
+
+		// The CLI acts as no user, so it can change any account's role.
+		if err := service.SetUserRole(ctx, user.ID, service.UserRole(os.Args[3]), 0); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to set role: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("user %s is now %s\n", os.Args[2], os.Args[3])
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -1,27 +1,155 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/logging"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
 	"github.com/ZacharyWM/greek-study-tool/server/router"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/ZacharyWM/greek-study-tool/server/tracing"
 )
 
 func main() {
-	appDir := filepath.Dir(os.Args[0])
-	dir, err := filepath.Abs(appDir)
+	logging.Setup()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(ctx)
 	if err != nil {
-		panic(err)
+		log.Fatalf("Error setting up tracing: %v", err)
 	}
-	dir = strings.TrimSuffix(dir, "tmp") // so it work with 'air' hot reloader
-	dir = strings.TrimSuffix(dir, "cmd") // so it works from debugger
 
 	database.InitDB()
 	database.RunMigrations()
+	metrics.RegisterDB(database.DB)
+
+	go func() {
+		count, err := service.BackfillAnalysisPassages(ctx)
+		if err != nil {
+			slog.Error("Failed to backfill analysis passages", "error", err)
+			return
+		}
+		slog.Info("Backfilled analysis passages", "analyses", count)
+	}()
+
+	go service.RunAccountPurger(ctx, time.Hour)
+	go service.RunTrashPurger(ctx, trashRetention(), time.Hour)
+
+	// FRONTEND_DIR serves the frontend from disk, e.g. "frontend" while
+	// running `npm run dev`; otherwise the embedded bundle is served.
+	r := router.New(os.Getenv("FRONTEND_DIR"))
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           r,
+		ReadHeaderTimeout: durationEnv("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       durationEnv("HTTP_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      durationEnv("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       durationEnv("HTTP_IDLE_TIMEOUT", 120*time.Second),
+	}
 
-	r := router.New(dir)
+	go func() {
+		slog.Info("Listening", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error running server: %v", err)
+		}
+	}()
+
+	// Metrics are only served on their own address, which can be kept off the
+	// public network.
+	var metricsServer *http.Server
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+		go func() {
+			slog.Info("Serving metrics", "addr", addr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Error running metrics server: %v", err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	stop()
+	slog.Info("Shutting down")
+
+	// Fail readiness first and keep serving for SHUTDOWN_DRAIN_DELAY, so load
+	// balancers see it and stop routing new requests here. Then let in-flight
+	// requests such as autosaves finish and disconnect live editors before
+	// closing the database.
+	router.Drain()
+	time.Sleep(durationEnv("SHUTDOWN_DRAIN_DELAY", 5*time.Second))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), durationEnv("SHUTDOWN_TIMEOUT", 20*time.Second))
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down server", "error", err)
+	}
+	if err := router.CloseLive(shutdownCtx); err != nil {
+		slog.Error("Error closing live editing connections", "error", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Error shutting down metrics server", "error", err)
+		}
+	}
+
+	database.Close()
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+}
+
+// trashRetention reads TRASH_RETENTION_DAYS, falling back to the default.
+func trashRetention() time.Duration {
+	value := os.Getenv("TRASH_RETENTION_DAYS")
+	if value == "" {
+		return service.DefaultTrashRetention
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		slog.Warn("Ignoring invalid TRASH_RETENTION_DAYS", "value", value)
+		return service.DefaultTrashRetention
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// durationEnv reads a duration such as "30s" from an environment variable,
+// falling back to the default.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		slog.Warn("Ignoring invalid duration", "name", name, "value", value)
+		return fallback
+	}
 
-	r.Run() // runs on env var PORT, or default 8080
+	return duration
 }
@@ -1,18 +1,41 @@
 import React from "react";
+import { useAuth0 } from "@auth0/auth0-react";
 import { Button } from "../components/ui/button";
-import type { Section } from "../types/models";
 
-const PdfExport: React.FC<{ sections: Section[] }> = ({ sections }) => {
-  const handleExport = () => {
-    // For now, we'll just log the sections to the console
-    console.log("Exporting sections:", sections);
-    // In the future, you can implement PDF generation and download here
-    alert("PDF export functionality will be implemented in the future.");
+const PdfExport: React.FC<{ analysisId: number }> = ({ analysisId }) => {
+  const { getAccessTokenSilently } = useAuth0();
+
+  const handleExport = async () => {
+    try {
+      const token = await getAccessTokenSilently();
+      const response = await fetch(`/api/analyses/${analysisId}/export.pdf`, {
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      });
+
+      if (!response.ok) {
+        console.error("Failed to export PDF:", await response.text());
+        return;
+      }
+
+      const blob = await response.blob();
+      const url = URL.createObjectURL(blob);
+      const link = document.createElement("a");
+      link.href = url;
+      link.download = `analysis-${analysisId}.pdf`;
+      link.click();
+      URL.revokeObjectURL(url);
+    } catch (error) {
+      console.error("Error exporting PDF:", error);
+    }
   };
 
   return (
     <div>
-      <Button onClick={handleExport}>Export PDF</Button>
+      <Button onClick={handleExport} disabled={!analysisId}>
+        Export PDF
+      </Button>
     </div>
   );
 };
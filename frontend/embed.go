@@ -0,0 +1,30 @@
+// Package frontend exposes frontend assets that the Go server needs at runtime.
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// SBLBibLit is the Greek font used by the editor, embedded for server-side rendering.
+//
+//go:embed style/SBLBibLit.ttf
+var SBLBibLit []byte
+
+// bundle is index.html and the built assets under build/, as they were when
+// the binary was compiled. Run `npm run build` and `npm run tw-build` first;
+// until then build/ only holds a .gitkeep.
+//
+//go:embed index.html all:build
+var bundle embed.FS
+
+// Bundle returns index.html and the build/ directory. When dir is set they are
+// read from the frontend directory on disk instead, so rebuilt assets are
+// served without recompiling the server.
+func Bundle(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return bundle
+}
@@ -6,6 +6,7 @@ import { useAuth0 } from "@auth0/auth0-react";
 import * as ScrollAreaPrimitive from "@radix-ui/react-scroll-area";
 import { useNavigate, useLocation } from "react-router-dom";
 import { Toaster } from "../components/ui/toaster";
+import { ToastAction } from "../components/ui/toast";
 import { useToast } from "../hooks/use-toast";
 
 interface Analysis {
@@ -16,22 +17,31 @@ interface Analysis {
   updated_at: string;
 }
 
+const historyPageSize = 25;
+
 export default function History() {
   const { isAuthenticated, getAccessTokenSilently } = useAuth0();
   const [history, setHistory] = useState<Analysis[]>([]);
   const [loadingHistory, setLoadingHistory] = useState(false);
+  // nextPage is the cursor for the following page, empty once all are loaded.
+  const [nextPage, setNextPage] = useState("");
+  const [loadingMore, setLoadingMore] = useState(false);
   const [selectedTag, setSelectedTag] = useState<string>("All");
   const navigate = useNavigate();
   const location = useLocation();
   const { toast } = useToast();
 
-  const fetchHistory = async () => {
+  // fetchHistory loads the first page, or appends the page after the given cursor.
+  const fetchHistory = async (page?: string) => {
     if (!isAuthenticated) return;
 
+    const setLoading = page ? setLoadingMore : setLoadingHistory;
     try {
-      setLoadingHistory(true);
+      setLoading(true);
       const token = await getAccessTokenSilently();
-      const response = await fetch(`/api/analyses`, {
+      // Passing limit asks for a page of results rather than the full list.
+      const query = `?limit=${historyPageSize}` + (page ? `&page=${encodeURIComponent(page)}` : "");
+      const response = await fetch(`/api/analyses${query}`, {
         headers: {
           Authorization: `Bearer ${token}`,
         },
@@ -39,14 +49,15 @@ export default function History() {
 
       if (response.ok) {
         const data = await response.json();
-        setHistory(data);
+        setHistory((current) => (page ? [...current, ...data.items] : data.items));
+        setNextPage(data.nextPage ?? "");
       } else {
         console.error("Failed to fetch history:", await response.text());
       }
     } catch (error) {
       console.error("Error fetching history:", error);
     } finally {
-      setLoadingHistory(false);
+      setLoading(false);
     }
   };
 
@@ -56,23 +67,49 @@ export default function History() {
       fetchHistory();
 
       const searchParams = new URLSearchParams(location.search);
-      if (searchParams.get("deleted") === "true") {
+      const deletedId = searchParams.get("deleted");
+      if (deletedId) {
         window.history.replaceState({}, document.title, location.pathname);
         const { dismiss } = toast({
           variant: "success",
           title: "Analysis Deleted",
-          description: "Your analysis was successfully deleted.",
+          description: "Your analysis was moved to the trash.",
           style: {
             backgroundColor: "#4caf50",
             color: "#fff",
           },
+          action: /^\d+$/.test(deletedId) ? (
+            <ToastAction altText="Undo" onClick={() => restoreAnalysis(deletedId)}>
+              Undo
+            </ToastAction>
+          ) : undefined,
         });
 
-        setTimeout(dismiss, 4000);
+        setTimeout(dismiss, 8000);
       }
     }
   }, [isAuthenticated, location.pathname, location.search]);
 
+  const restoreAnalysis = async (id: string) => {
+    try {
+      const token = await getAccessTokenSilently();
+      const response = await fetch(`/api/analyses/${id}/restore`, {
+        method: "POST",
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      });
+
+      if (response.ok) {
+        fetchHistory();
+      } else {
+        console.error("Failed to restore analysis:", await response.text());
+      }
+    } catch (error) {
+      console.error("Error restoring analysis:", error);
+    }
+  };
+
   const handleAnalysisClick = (id: number) => {
     navigate(`/analysis/${id}`);
   };
@@ -111,6 +148,15 @@ export default function History() {
                   </div>
                 </div>
               ))}
+              {nextPage && (
+                <Button
+                  variant="outline"
+                  disabled={loadingMore}
+                  onClick={() => fetchHistory(nextPage)}
+                >
+                  {loadingMore ? "Loading..." : "Load more"}
+                </Button>
+              )}
             </div>
           ) : (
             <div className="text-center py-10 text-muted-foreground">
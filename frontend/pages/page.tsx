@@ -544,6 +544,7 @@ export default function Home() {
       const words = inputText.split(/\s+/).map((word, index) => ({
         id: index + 1,
         text: word,
+        corpusWordId: findWord(word)?.id,
         lexicalForm: findWord(word)?.lemma || "",
         glossaryDefinition: findWord(word)?.definition || "",
         strongs: findWord(word)?.strong || "",
@@ -677,7 +678,7 @@ export default function Home() {
     if (!isAuthenticated) return;
     if (
       window.confirm(
-        "Are you sure you want to delete this analysis? This action cannot be undone."
+        "Are you sure you want to delete this analysis? It will be moved to the trash."
       )
     ) {
       try {
@@ -695,7 +696,7 @@ export default function Home() {
           requestOptions
         );
         if (response.ok) {
-          navigate("/analyses?deleted=true");
+          navigate(`/analyses?deleted=${analysisId}`);
         } else {
           console.error("Failed to delete analysis:", await response.text());
         }
@@ -767,6 +768,33 @@ export default function Home() {
     }
   };
 
+  // New analyses open with the layout preset the user prefers.
+  useEffect(() => {
+    if (!isAuthenticated || analysisId > 0) return;
+
+    const applyPreferredLayout = async () => {
+      try {
+        const token = await getAccessTokenSilently();
+        const response = await fetch("/api/me/preferences", {
+          headers: {
+            Authorization: `Bearer ${token}`,
+          },
+        });
+        if (!response.ok) {
+          console.error("Failed to fetch preferences:", await response.text());
+          return;
+        }
+        const preferences = await response.json();
+        if (preferences.layoutPreset) {
+          setLayout(preferences.layoutPreset);
+        }
+      } catch (error) {
+        console.error("Error fetching preferences:", error);
+      }
+    };
+    applyPreferredLayout();
+  }, [isAuthenticated, analysisId]);
+
   // Get verses from the first section
   const sectionVerses = sections.length > 0 ? extractVerses(sections[0]) : [];
 
@@ -8,6 +8,7 @@ export interface Word {
   lexicalForm?: string;
   glossaryDefinition?: string;
   strongs?: string;
+  corpusWordId?: number;
 }
 
 export interface WordParsing {
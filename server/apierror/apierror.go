@@ -0,0 +1,169 @@
+// Package apierror is the error model of the HTTP API. Every error response
+// has the same envelope:
+//
+//	{"error": {"code": "not_found", "message": "...", "requestId": "...", "details": ...}}
+//
+// The cause of an error is logged by the access log, but clients of internal
+// errors only see a generic message.
+package apierror
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/ZacharyWM/greek-study-tool/server/logging"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Codes identify the kind of error. Unlike messages, they do not change.
+const (
+	CodeInvalid         = "invalid_argument"
+	CodeUnauthenticated = "unauthenticated"
+	CodeForbidden       = "permission_denied"
+	CodeNotFound        = "not_found"
+	CodeConflict        = "conflict"
+	CodeTooLarge        = "payload_too_large"
+	CodeUnprocessable   = "unprocessable"
+	CodeUnavailable     = "unavailable"
+	CodeInternal        = "internal"
+)
+
+const internalMessage = "Internal server error"
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeInvalid,
+	http.StatusUnauthorized:          CodeUnauthenticated,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodeTooLarge,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusInternalServerError:   CodeInternal,
+}
+
+// Error is an error as the API reports it.
+type Error struct {
+	Status    int         `json:"-"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"requestId,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+	// Cause is logged but never sent to the client.
+	Cause error `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// WithDetails returns a copy of the error carrying machine-readable details.
+func (e *Error) WithDetails(details interface{}) *Error {
+	withDetails := *e
+	withDetails.Details = details
+	return &withDetails
+}
+
+// New returns an error with the given status and message.
+func New(status int, message string) *Error {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+	}
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Wrap returns an error with the given status and message, caused by err.
+func Wrap(err error, status int, message string) *Error {
+	e := New(status, message)
+	e.Cause = err
+	return e
+}
+
+// serviceKinds maps the kinds of service error onto the statuses they are
+// reported with.
+var serviceKinds = []struct {
+	kind   error
+	status int
+}{
+	{service.ErrNotFound, http.StatusNotFound},
+	{service.ErrForbidden, http.StatusForbidden},
+	{service.ErrInvalid, http.StatusBadRequest},
+	{service.ErrConflict, http.StatusConflict},
+}
+
+// From converts err to the error it is reported as. Service errors of a known
+// kind keep their message; anything else is an internal error.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, serviceKind := range serviceKinds {
+		if errors.Is(err, serviceKind.kind) {
+			return Wrap(err, serviceKind.status, err.Error())
+		}
+	}
+
+	return Wrap(err, http.StatusInternalServerError, internalMessage)
+}
+
+// FromError reports err, an error about the request such as a decoding error,
+// with the given status and its text as the message. Errors From knows about
+// are reported as it says, and errors that come from the database or the
+// network, or are reported as a 5xx, are internal errors so their text is not
+// exposed.
+func FromError(status int, err error) *Error {
+	if apiErr := From(err); apiErr.Status != http.StatusInternalServerError {
+		return apiErr
+	}
+
+	if status >= http.StatusInternalServerError || isInternal(err) {
+		return Wrap(err, http.StatusInternalServerError, internalMessage)
+	}
+
+	return Wrap(err, status, err.Error())
+}
+
+// isInternal reports whether err is a failure of the server's dependencies
+// rather than a problem with the request.
+func isInternal(err error) bool {
+	var pqErr *pq.Error
+	var netErr net.Error
+	return errors.As(err, &pqErr) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, sql.ErrTxDone) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// Abort writes err, as From converts it, as the error envelope and stops the
+// handler chain.
+func Abort(c *gin.Context, err error) {
+	apiErr := From(err)
+
+	response := *apiErr
+	response.RequestID = logging.RequestID(c.Request.Context())
+
+	// The access log reports the cause.
+	if apiErr.Cause != nil {
+		c.Error(apiErr.Cause)
+	}
+
+	c.AbortWithStatusJSON(response.Status, gin.H{"error": response})
+}
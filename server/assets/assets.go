@@ -0,0 +1,267 @@
+// Package assets serves the frontend bundle: index.html and the scripts,
+// styles and fonts it loads.
+//
+// Assets are served under content-hashed names, so they can be cached forever,
+// and precompressed with brotli and gzip. In dev mode files are read from disk
+// on every request instead, uncompressed and uncached, for live reloading.
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	indexFile = "index.html"
+
+	// hashLength is how many hex digits of the content hash go in file names.
+	hashLength = 12
+
+	immutableCache = "public, max-age=31536000, immutable"
+	revalidate     = "no-cache"
+)
+
+// bundleFiles maps the URLs index.html refers to onto the files in the bundle.
+// Files are listed before those that refer to them, so references can be
+// rewritten to hashed names before the referring file is itself hashed.
+var bundleFiles = []struct {
+	url  string
+	file string
+}{
+	{"/assets/SBLBibLit.ttf", "build/SBLBibLit.ttf"},
+	{"/assets/output.css", "build/style.css"},
+	{"/assets/app.js", "build/App.js"},
+}
+
+// textTypes are the content types whose references to other assets are
+// rewritten to the hashed names.
+var textTypes = []string{"text/html", "text/css", "text/javascript", "application/javascript"}
+
+type asset struct {
+	contentType string
+	etag        string
+	body        []byte
+	gzip        []byte
+	brotli      []byte
+}
+
+// Server serves the frontend bundle.
+type Server struct {
+	files fs.FS
+	dev   bool
+
+	index *asset
+	// byURL holds every asset by both its hashed and its plain URL. Plain URLs
+	// keep working for anything that still refers to them, but are revalidated.
+	byURL  map[string]*asset
+	hashed map[string]bool
+}
+
+// New prepares the bundle in files for serving. In dev mode nothing is
+// prepared up front and files is read on every request.
+func New(files fs.FS, dev bool) (*Server, error) {
+	s := &Server{files: files, dev: dev, byURL: map[string]*asset{}, hashed: map[string]bool{}}
+	if dev {
+		return s, nil
+	}
+
+	// renames maps each reference to an asset onto its hashed name.
+	renames := map[string]string{}
+	for _, bundleFile := range bundleFiles {
+		a, err := load(files, bundleFile.file, renames)
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Frontend asset missing from the bundle; run the frontend build", "file", bundleFile.file)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ext := path.Ext(bundleFile.url)
+		hashedURL := strings.TrimSuffix(bundleFile.url, ext) + "." + a.etag + ext
+		renames[bundleFile.url] = hashedURL
+		renames["./"+path.Base(bundleFile.url)] = "./" + path.Base(hashedURL)
+
+		a.compress()
+		s.byURL[bundleFile.url] = a
+		s.byURL[hashedURL] = a
+		s.hashed[hashedURL] = true
+	}
+
+	index, err := load(files, indexFile, renames)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", indexFile, err)
+	}
+	index.compress()
+	s.index = index
+
+	return s, nil
+}
+
+// load reads a file from the bundle, rewriting references in text files.
+func load(files fs.FS, name string, renames map[string]string) (*asset, error) {
+	body, err := fs.ReadFile(files, name)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	if isText(contentType) {
+		for from, to := range renames {
+			body = bytes.ReplaceAll(body, []byte(from), []byte(to))
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	return &asset{
+		contentType: contentType,
+		etag:        hex.EncodeToString(sum[:])[:hashLength],
+		body:        body,
+	}, nil
+}
+
+func isText(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	for _, textType := range textTypes {
+		if mediaType == textType {
+			return true
+		}
+	}
+	return false
+}
+
+// compress precomputes the brotli and gzip variants, keeping only those that
+// are actually smaller.
+func (a *asset) compress() {
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := bw.Write(a.body); err == nil && bw.Close() == nil && buf.Len() < len(a.body) {
+		a.brotli = bytes.Clone(buf.Bytes())
+	}
+
+	buf.Reset()
+	gw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if _, err := gw.Write(a.body); err == nil && gw.Close() == nil && buf.Len() < len(a.body) {
+		a.gzip = bytes.Clone(buf.Bytes())
+	}
+}
+
+// Register adds the routes for index.html and the assets, and serves
+// index.html for any other route so the frontend can handle it.
+func (s *Server) Register(r *gin.Engine) {
+	r.GET("/", s.ServeIndex)
+	r.HEAD("/", s.ServeIndex)
+	r.GET("/assets/*file", s.serveAsset)
+	r.HEAD("/assets/*file", s.serveAsset)
+	r.NoRoute(s.ServeIndex)
+}
+
+// ServeIndex serves index.html. It must always be revalidated, since it is
+// what points browsers at the current assets.
+func (s *Server) ServeIndex(c *gin.Context) {
+	if !s.dev {
+		serve(c, s.index, revalidate)
+		return
+	}
+
+	index, err := load(s.files, indexFile, nil)
+	if err != nil {
+		slog.Error("Failed to load index.html", "error", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	serve(c, index, revalidate)
+}
+
+func (s *Server) serveAsset(c *gin.Context) {
+	url := c.Request.URL.Path
+
+	if !s.dev {
+		a, ok := s.byURL[url]
+		if !ok {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		cacheControl := revalidate
+		if s.hashed[url] {
+			cacheControl = immutableCache
+		}
+		serve(c, a, cacheControl)
+		return
+	}
+
+	for _, bundleFile := range bundleFiles {
+		if bundleFile.url != url {
+			continue
+		}
+		a, err := load(s.files, bundleFile.file, nil)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		serve(c, a, revalidate)
+		return
+	}
+	c.Status(http.StatusNotFound)
+}
+
+// serve writes the asset in the best encoding the client accepts.
+func serve(c *gin.Context, a *asset, cacheControl string) {
+	etag := `"` + a.etag + `"`
+	c.Header("Cache-Control", cacheControl)
+	c.Header("ETag", etag)
+	c.Header("Vary", "Accept-Encoding")
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	body := a.body
+	accepted := acceptedEncodings(c.GetHeader("Accept-Encoding"))
+	switch {
+	case a.brotli != nil && accepted["br"]:
+		c.Header("Content-Encoding", "br")
+		body = a.brotli
+	case a.gzip != nil && accepted["gzip"]:
+		c.Header("Content-Encoding", "gzip")
+		body = a.gzip
+	}
+
+	c.Data(http.StatusOK, a.contentType, body)
+}
+
+// acceptedEncodings parses an Accept-Encoding header, leaving out encodings
+// the client refuses with q=0.
+func acceptedEncodings(header string) map[string]bool {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(coding))] = true
+	}
+	return accepted
+}
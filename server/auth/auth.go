@@ -3,7 +3,8 @@ package auth
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"time"
@@ -12,48 +13,148 @@ import (
 	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/oauth2"
 )
 
-var (
-	AUTH0_CLIENT_ID     = envOrDefault("AUTH0_CLIENT_ID", "epvq6lnMUVpNxVOYaoYtADPxeFwqgcY0")
-	AUTH0_DOMAIN        = envOrDefault("AUTH0_DOMAIN", "zachsauth.us.auth0.com")
-	AUTH0_CLIENT_SECRET = "" // Not needed for JWT validation
-	AUTH0_CALLBACK_URL  = envOrDefault("AUTH0_CALLBACK_URL", "https://zachm.dev/callback")
+// Config describes the OpenID Connect provider the server signs in with. Any
+// issuer that supports discovery works, such as Auth0, Keycloak, Authentik or
+// Google.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	CallbackURL  string
+	// Audience is the audience API access tokens must be issued for.
+	Audience string
+	// HTTPClient talks to the provider; nil means http.DefaultClient.
+	HTTPClient *http.Client
+}
 
-	AUTH0_AUDIENCE      = envOrDefault("AUTH0_AUDIENCE", "https://zachsauth.us.auth0.com/api/v2/")
-	AUTH0_USER_INFO_URL = envOrDefault("AUTH0_USER_INFO_URL", "https://zachsauth.us.auth0.com/userinfo")
-)
+// ConfigFromEnv reads the provider from the OIDC_* environment variables,
+// falling back to the older AUTH0_* ones.
+func ConfigFromEnv() Config {
+	domain := envOrDefault("AUTH0_DOMAIN", "zachsauth.us.auth0.com")
+
+	return Config{
+		IssuerURL:    envOrDefault("OIDC_ISSUER_URL", "https://"+domain+"/"),
+		ClientID:     envOrDefault("OIDC_CLIENT_ID", envOrDefault("AUTH0_CLIENT_ID", "epvq6lnMUVpNxVOYaoYtADPxeFwqgcY0")),
+		ClientSecret: envOrDefault("OIDC_CLIENT_SECRET", os.Getenv("AUTH0_CLIENT_SECRET")),
+		CallbackURL:  envOrDefault("OIDC_CALLBACK_URL", envOrDefault("AUTH0_CALLBACK_URL", "https://zachm.dev/callback")),
+		Audience:     envOrDefault("OIDC_AUDIENCE", envOrDefault("AUTH0_AUDIENCE", "https://"+domain+"/api/v2/")),
+	}
+}
 
+// IdentityProvider signs users in and validates the access tokens sent to the
+// API.
+type IdentityProvider interface {
+	// Issuer is the issuer URL tokens are checked against.
+	Issuer() string
+	LoginURL(state, nonce, verifier string) string
+	ExchangeCode(ctx context.Context, code, verifier string) (*oauth2.Token, error)
+	VerifyIDToken(ctx context.Context, token *oauth2.Token, nonce string) (*oidc.IDToken, error)
+	// UserInfo fetches the profile of the user an access token belongs to.
+	UserInfo(ctx context.Context, accessToken string) (Profile, error)
+	// LogoutURL returns where to send the browser to end the provider's
+	// session, or "" when the provider has no end_session_endpoint.
+	LogoutURL(returnTo, idTokenHint string) string
+	ValidateAccessToken(ctx context.Context, token string) (*validator.ValidatedClaims, error)
+}
+
+// Authenticator is an IdentityProvider for any OpenID Connect issuer,
+// configured through discovery.
 type Authenticator struct {
 	*oidc.Provider
 	oauth2.Config
+
+	issuer             string
+	endSessionEndpoint string
+	client             *http.Client
+	validator          *validator.Validator
 }
 
-func New() (*Authenticator, error) {
-	provider, err := oidc.NewProvider(
-		context.Background(),
-		"https://"+AUTH0_DOMAIN+"/",
-	)
+// New discovers the provider described by config.
+func New(ctx context.Context, config Config) (*Authenticator, error) {
+	client := http.DefaultClient
+	if config.HTTPClient != nil {
+		client = config.HTTPClient
+	}
+
+	// Discovery, JWKS, token and userinfo calls get client spans under the
+	// request that made them.
+	traced := *client
+	traced.Transport = otelhttp.NewTransport(client.Transport)
+	client = &traced
+
+	// The provider keeps this context to fetch its signing keys later.
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.WithoutCancel(ctx), client), config.IssuerURL)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error discovering %s: %w", config.IssuerURL, err)
 	}
 
-	conf := oauth2.Config{
-		ClientID:     AUTH0_CLIENT_ID,
-		ClientSecret: AUTH0_CLIENT_SECRET,
-		RedirectURL:  AUTH0_CALLBACK_URL,
-		Endpoint:     provider.Endpoint(),
-		Scopes:       []string{oidc.ScopeOpenID, "profile"},
+	var metadata struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := provider.Claims(&metadata); err != nil {
+		return nil, fmt.Errorf("error reading provider metadata: %w", err)
+	}
+
+	issuerURL, err := url.Parse(config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer URL: %w", err)
+	}
+
+	// Auth0 also issues tokens for its userinfo endpoint as an audience.
+	audience := []string{config.Audience}
+	if provider.UserInfoEndpoint() != "" {
+		audience = append(audience, provider.UserInfoEndpoint())
+	}
+
+	keys := jwks.NewCachingProvider(issuerURL, 5*time.Minute, jwks.WithCustomClient(client))
+	jwtValidator, err := validator.New(keys.KeyFunc, validator.RS256, config.IssuerURL, audience,
+		validator.WithCustomClaims(func() validator.CustomClaims { return &Profile{} }),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up the jwt validator: %w", err)
 	}
 
 	return &Authenticator{
 		Provider: provider,
-		Config:   conf,
+		Config: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.CallbackURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		issuer:             config.IssuerURL,
+		endSessionEndpoint: metadata.EndSessionEndpoint,
+		client:             client,
+		validator:          jwtValidator,
 	}, nil
 }
 
-func (a *Authenticator) VerifyIDToken(ctx context.Context, token *oauth2.Token) (*oidc.IDToken, error) {
+// Issuer returns the issuer URL.
+func (a *Authenticator) Issuer() string {
+	return a.issuer
+}
+
+// LoginURL returns the authorization endpoint URL for a PKCE-protected
+// authorization-code login. The state, nonce and verifier must be kept until
+// the callback.
+func (a *Authenticator) LoginURL(state, nonce, verifier string) string {
+	return a.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce))
+}
+
+// ExchangeCode exchanges an authorization code for tokens, proving possession
+// of the PKCE verifier.
+func (a *Authenticator) ExchangeCode(ctx context.Context, code, verifier string) (*oauth2.Token, error) {
+	return a.Exchange(oidc.ClientContext(ctx, a.client), code, oauth2.VerifierOption(verifier))
+}
+
+// VerifyIDToken verifies the ID token returned with token and checks that it
+// carries the nonce sent with the login request.
+func (a *Authenticator) VerifyIDToken(ctx context.Context, token *oauth2.Token, nonce string) (*oidc.IDToken, error) {
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok {
 		return nil, errors.New("no id_token field in oauth2 token")
@@ -63,30 +164,114 @@ func (a *Authenticator) VerifyIDToken(ctx context.Context, token *oauth2.Token)
 		ClientID: a.ClientID,
 	}
 
-	return a.Verifier(oidcConfig).Verify(ctx, rawIDToken)
+	idToken, err := a.Verifier(oidcConfig).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+
+	return idToken, nil
+}
+
+// Profile is the user profile carried by the ID token, and by access tokens
+// from providers that include it there.
+type Profile struct {
+	Subject       string `json:"sub"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Nickname      string `json:"nickname"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// Roles are app roles granted by the provider, on top of those stored for
+	// the user.
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Validate lets Profile be parsed as an access token's custom claims; there is
+// nothing in it to check.
+func (p *Profile) Validate(ctx context.Context) error {
+	return nil
+}
+
+// ProfileFromClaims returns the profile carried by validated token claims,
+// which may be empty apart from the subject.
+func ProfileFromClaims(claims *validator.ValidatedClaims) Profile {
+	var profile Profile
+	if custom, ok := claims.CustomClaims.(*Profile); ok && custom != nil {
+		profile = *custom
+	}
+	profile.Subject = claims.RegisteredClaims.Subject
+
+	return profile
 }
 
-func GetJwtValidator() *validator.Validator {
-	issuerURL, err := url.Parse("https://" + AUTH0_DOMAIN + "/")
+// UserInfo fetches the profile of the user accessToken belongs to from the
+// provider's userinfo endpoint.
+func (a *Authenticator) UserInfo(ctx context.Context, accessToken string) (Profile, error) {
+	var profile Profile
+
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken, TokenType: "Bearer"})
+	userInfo, err := a.Provider.UserInfo(oidc.ClientContext(ctx, a.client), tokenSource)
 	if err != nil {
-		log.Fatalf("Failed to parse the issuer url: %v", err)
+		return profile, fmt.Errorf("error fetching user info: %w", err)
 	}
 
-	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
+	if err := userInfo.Claims(&profile); err != nil {
+		return profile, fmt.Errorf("error parsing user info: %w", err)
+	}
 
-	jwtValidator, err := validator.New(
-		provider.KeyFunc,
-		validator.RS256,
-		issuerURL.String(),
-		[]string{
-			AUTH0_AUDIENCE,
-			AUTH0_USER_INFO_URL,
-		},
-	)
+	return profile, nil
+}
+
+// LogoutURL returns the provider's RP-initiated logout URL, or "" when the
+// provider does not advertise an end_session_endpoint.
+func (a *Authenticator) LogoutURL(returnTo, idTokenHint string) string {
+	if a.endSessionEndpoint == "" {
+		return ""
+	}
+
+	logoutURL, err := url.Parse(a.endSessionEndpoint)
+	if err != nil {
+		return ""
+	}
+
+	parameters := logoutURL.Query()
+	parameters.Set("client_id", a.ClientID)
+	parameters.Set("post_logout_redirect_uri", returnTo)
+	if idTokenHint != "" {
+		parameters.Set("id_token_hint", idTokenHint)
+	}
+	logoutURL.RawQuery = parameters.Encode()
+
+	return logoutURL.String()
+}
+
+// ValidateAccessToken checks an API access token's signature, issuer,
+// audience and expiry.
+func (a *Authenticator) ValidateAccessToken(ctx context.Context, token string) (*validator.ValidatedClaims, error) {
+	validated, err := a.validator.ValidateToken(ctx, token)
 	if err != nil {
-		log.Fatalf("Failed to set up the jwt validator")
+		return nil, err
+	}
+
+	return validated.(*validator.ValidatedClaims), nil
+}
+
+// SessionClaims builds the claims of a browser session so that handlers see
+// session and bearer requests alike.
+func SessionClaims(issuer string, subject string, expiry time.Time) *validator.ValidatedClaims {
+	return &validator.ValidatedClaims{
+		RegisteredClaims: validator.RegisteredClaims{
+			Issuer:  issuer,
+			Subject: subject,
+			Expiry:  expiry.Unix(),
+		},
 	}
-	return jwtValidator
 }
 
 func ClaimsFromContext(ctx *gin.Context) *validator.ValidatedClaims {
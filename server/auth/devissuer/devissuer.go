@@ -0,0 +1,407 @@
+// Package devissuer is a minimal OpenID Connect issuer for development and
+// tests. It signs in anyone without asking, so it must never be enabled in
+// production. It serves discovery, JWKS, an authorization endpoint that
+// approves every request, a PKCE-checking token endpoint, userinfo and
+// end-session, and can mint access tokens directly.
+package devissuer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	keyID      = "dev"
+	tokenTTL   = time.Hour
+	codeTTL    = time.Minute
+	defaultSub = "dev|user"
+)
+
+// Issuer is an in-process OpenID Connect issuer.
+type Issuer struct {
+	issuer   string
+	base     *url.URL
+	clientID string
+	audience string
+	key      *rsa.PrivateKey
+	signer   jose.Signer
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	subject     string
+	nonce       string
+	challenge   string
+	redirectURI string
+	expiresAt   time.Time
+}
+
+// New creates an issuer at issuerURL for the given client and access token
+// audience; tokens carry issuerURL exactly as given as their iss claim. The
+// signing key is read from the PEM file at keyFile, so tokens stay valid
+// across restarts, or generated when keyFile is empty.
+func New(issuerURL, clientID, audience, keyFile string) (*Issuer, error) {
+	u, err := url.Parse(strings.TrimSuffix(issuerURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer URL: %w", err)
+	}
+
+	key, err := loadKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating signer: %w", err)
+	}
+
+	return &Issuer{
+		issuer:   issuerURL,
+		base:     u,
+		clientID: clientID,
+		audience: audience,
+		key:      key,
+		signer:   signer,
+		codes:    make(map[string]authorization),
+	}, nil
+}
+
+func loadKey(keyFile string) (*rsa.PrivateKey, error) {
+	if keyFile == "" {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("key file is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key file does not hold an RSA key")
+	}
+
+	return key, nil
+}
+
+// URL returns the issuer URL.
+func (i *Issuer) URL() string {
+	return i.issuer
+}
+
+// endpoint returns the URL of one of the issuer's endpoints.
+func (i *Issuer) endpoint(name string) string {
+	return i.base.String() + name
+}
+
+// Handler serves the issuer's endpoints under the issuer URL's path.
+func (i *Issuer) Handler() http.Handler {
+	base := i.base.Path
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+base+"/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("GET "+base+"/jwks.json", i.jwks)
+	mux.HandleFunc("GET "+base+"/authorize", i.authorize)
+	mux.HandleFunc("POST "+base+"/token", i.token)
+	mux.HandleFunc("GET "+base+"/userinfo", i.userInfo)
+	mux.HandleFunc("GET "+base+"/logout", i.logout)
+	mux.HandleFunc("GET "+base+"/mint", i.mint)
+
+	return mux
+}
+
+// Client returns an HTTP client that serves requests from the issuer's
+// handler in-process, so no network is needed to talk to it.
+func (i *Issuer) Client() *http.Client {
+	handler := i.Handler()
+
+	return &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+			return recorder.Result(), nil
+		}),
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// MintAccessToken returns a signed access token for subject.
+func (i *Issuer) MintAccessToken(subject string) (string, error) {
+	now := time.Now()
+
+	return jwt.Signed(i.signer).Claims(jwt.Claims{
+		Issuer:   i.issuer,
+		Subject:  subject,
+		Audience: jwt.Audience{i.audience},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(tokenTTL)),
+	}).Claims(map[string]interface{}{
+		"scope": "openid profile email",
+	}).Serialize()
+}
+
+// mintIDToken returns a signed ID token for subject with its profile.
+func (i *Issuer) mintIDToken(subject, nonce string) (string, error) {
+	now := time.Now()
+
+	builder := jwt.Signed(i.signer).Claims(jwt.Claims{
+		Issuer:   i.issuer,
+		Subject:  subject,
+		Audience: jwt.Audience{i.clientID},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(tokenTTL)),
+	}).Claims(profile(subject))
+
+	if nonce != "" {
+		builder = builder.Claims(map[string]interface{}{"nonce": nonce})
+	}
+
+	return builder.Serialize()
+}
+
+// profile makes up a stable profile for a subject.
+func profile(subject string) map[string]interface{} {
+	name := subject
+	if i := strings.LastIndex(subject, "|"); i >= 0 {
+		name = subject[i+1:]
+	}
+
+	return map[string]interface{}{
+		"sub":            subject,
+		"name":           name,
+		"nickname":       name,
+		"given_name":     name,
+		"email":          name + "@example.test",
+		"email_verified": true,
+	}
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                i.issuer,
+		"authorization_endpoint":                i.endpoint("/authorize"),
+		"token_endpoint":                        i.endpoint("/token"),
+		"userinfo_endpoint":                     i.endpoint("/userinfo"),
+		"jwks_uri":                              i.endpoint("/jwks.json"),
+		"end_session_endpoint":                  i.endpoint("/logout"),
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &i.key.PublicKey,
+		KeyID:     keyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+// authorize approves every request. The subject is taken from login_hint.
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != i.clientID {
+		http.Error(w, "unsupported response_type or unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	subject := query.Get("login_hint")
+	if subject == "" {
+		subject = defaultSub
+	}
+
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	i.mu.Lock()
+	i.codes[code] = authorization{
+		subject:     subject,
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		redirectURI: redirectURI.String(),
+		expiresAt:   time.Now().Add(codeTTL),
+	}
+	i.mu.Unlock()
+
+	values := redirectURI.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirectURI.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	i.mu.Lock()
+	auth, ok := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+
+	if !ok || time.Now().After(auth.expiresAt) || r.PostForm.Get("redirect_uri") != auth.redirectURI {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	accessToken, err := i.MintAccessToken(auth.subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, err := i.mintIDToken(auth.subject, auth.nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"id_token":     idToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenTTL.Seconds()),
+	})
+}
+
+func (i *Issuer) userInfo(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	token, err := jwt.ParseSigned(raw, []jose.SignatureAlgorithm{jose.RS256})
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var claims jwt.Claims
+	if err := token.Claims(&i.key.PublicKey, &claims); err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if err := claims.Validate(jwt.Expected{Issuer: i.issuer, Time: time.Now()}); err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, profile(claims.Subject))
+}
+
+func (i *Issuer) logout(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.URL.Query().Get("post_logout_redirect_uri")
+	if returnTo == "" {
+		returnTo = "/"
+	}
+
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// mint returns an access token for ?sub=, for calling the API from scripts.
+func (i *Issuer) mint(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("sub")
+	if subject == "" {
+		subject = defaultSub
+	}
+
+	token, err := i.MintAccessToken(subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenTTL.Seconds()),
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-contrib/sessions/postgres"
+)
+
+// SessionName is the name of the session cookie.
+const SessionName = "greek_study_session"
+
+// SessionLifetime is how long a browser session stays logged in.
+const SessionLifetime = 7 * 24 * time.Hour
+
+// Session keys.
+const (
+	SessionState     = "state"
+	SessionNonce     = "nonce"
+	SessionVerifier  = "verifier"
+	SessionSubject   = "sub"
+	SessionExpiresAt = "expires_at"
+	SessionIDToken   = "id_token"
+)
+
+// NewSessionStore creates the session store configured by SESSION_STORE:
+// "cookie" (the default) keeps sessions in signed and encrypted cookies, and
+// "postgres" keeps them in the database. SESSION_SECRET signs them; without it
+// a random secret is used and sessions do not survive a restart.
+func NewSessionStore(db *sql.DB) (sessions.Store, error) {
+	authKey, encryptionKey, err := sessionKeys(os.Getenv("SESSION_SECRET"))
+	if err != nil {
+		return nil, err
+	}
+
+	var store sessions.Store
+	switch kind := envOrDefault("SESSION_STORE", "cookie"); kind {
+	case "cookie":
+		store = cookie.NewStore(authKey, encryptionKey)
+	case "postgres":
+		store, err = postgres.NewStore(db, authKey, encryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("error creating postgres session store: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown SESSION_STORE %q", kind)
+	}
+
+	store.Options(sessions.Options{
+		Path:     "/",
+		MaxAge:   int(SessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   os.Getenv("SESSION_INSECURE") != "true",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return store, nil
+}
+
+// sessionKeys derives a 32-byte authentication key and a 32-byte encryption
+// key from the secret.
+func sessionKeys(secret string) ([]byte, []byte, error) {
+	if secret == "" {
+		slog.Warn("SESSION_SECRET is not set; using a random secret, sessions will not survive a restart")
+		keys := make([]byte, 64)
+		if _, err := rand.Read(keys); err != nil {
+			return nil, nil, err
+		}
+		return keys[:32], keys[32:], nil
+	}
+
+	if len(secret) < 64 {
+		return nil, nil, fmt.Errorf("SESSION_SECRET must be at least 64 characters")
+	}
+
+	return []byte(secret[:32]), []byte(secret[32:64]), nil
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -8,11 +9,17 @@ import (
 
 	_ "embed"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 var DB *sql.DB
 
+// SchemaVersion is the schema version RunMigrations brings the database to.
+// Bump it whenever a migration is added.
+const SchemaVersion = 18
+
 // TODO - replace with env vars
 const (
 	host     = "127.0.0.1"
@@ -31,7 +38,16 @@ func InitDB() {
 	// connectionString = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbName)
 
 	var err error
-	DB, err = sql.Open("postgres", connectionString)
+	// Every query gets a span under the request that made it when tracing is
+	// enabled.
+	DB, err = otelsql.Open("postgres", connectionString,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
 		log.Fatalf("Error opening database: %v", err)
 	}
@@ -44,6 +60,36 @@ func InitDB() {
 	slog.Info("Database connection established")
 }
 
+// Ready reports whether the database is reachable and its schema is at least
+// the version this binary expects.
+func Ready(ctx context.Context) error {
+	if err := DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	var version int
+	err := DB.QueryRowContext(ctx, `SELECT version FROM schema_version`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+
+	if version < SchemaVersion {
+		return fmt.Errorf("schema version is %d, expected at least %d", version, SchemaVersion)
+	}
+
+	return nil
+}
+
+// Close closes the database connection pool.
+func Close() {
+	if err := DB.Close(); err != nil {
+		slog.Error("Error closing database", "error", err)
+		return
+	}
+
+	slog.Info("Database connection closed")
+}
+
 // TODO - work out a better migration strategy
 func RunMigrations() {
 	/*
@@ -198,5 +244,300 @@ func RunMigrations() {
 		}
 	*/
 
-	slog.Info("Database migrations completed")
+	createAnalysisSharesTableCmd := `
+		CREATE TABLE IF NOT EXISTS analysis_shares (
+			id SERIAL PRIMARY KEY,
+			analysis_id INTEGER NOT NULL REFERENCES analyses(id) ON DELETE CASCADE,
+			token VARCHAR(64) NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_analysis_shares_token ON analysis_shares(token);
+		CREATE INDEX IF NOT EXISTS idx_analysis_shares_analysis_id ON analysis_shares(analysis_id);
+	`
+	_, err := DB.Exec(createAnalysisSharesTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating analysis_shares table: %v", err)
+	}
+
+	createAnalysisMembersTableCmd := `
+		CREATE TABLE IF NOT EXISTS analysis_members (
+			analysis_id INTEGER NOT NULL REFERENCES analyses(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (analysis_id, user_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_analysis_members_user_id ON analysis_members(user_id);
+	`
+	_, err = DB.Exec(createAnalysisMembersTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating analysis_members table: %v", err)
+	}
+
+	addDeleteAfterToUsersCmd := `
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS delete_after TIMESTAMP WITH TIME ZONE;
+	`
+	_, err = DB.Exec(addDeleteAfterToUsersCmd)
+	if err != nil {
+		log.Fatalf("Error adding delete_after to users table: %v", err)
+	}
+
+	// Audit records outlive the users they describe, so they keep the IdP ID instead of a foreign key.
+	createAuditLogTableCmd := `
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER,
+			idp_id VARCHAR(255),
+			action VARCHAR(100) NOT NULL,
+			details JSONB,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id);
+	`
+	_, err = DB.Exec(createAuditLogTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating audit_log table: %v", err)
+	}
+
+	createFoldersTableCmd := `
+		CREATE TABLE IF NOT EXISTS folders (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_user_id_name ON folders(user_id, name);
+	`
+	_, err = DB.Exec(createFoldersTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating folders table: %v", err)
+	}
+
+	createAnalysisTagsTableCmd := `
+		CREATE TABLE IF NOT EXISTS analysis_tags (
+			analysis_id INTEGER NOT NULL REFERENCES analyses(id) ON DELETE CASCADE,
+			tag VARCHAR(50) NOT NULL,
+			PRIMARY KEY (analysis_id, tag)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_analysis_tags_tag ON analysis_tags(tag);
+	`
+	_, err = DB.Exec(createAnalysisTagsTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating analysis_tags table: %v", err)
+	}
+
+	// Search covers the title, description and every translation string in the details.
+	addAnalysesSearchVectorCmd := `
+		ALTER TABLE analyses ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(description, '')), 'B') ||
+			setweight(jsonb_to_tsvector('simple',
+				coalesce(jsonb_path_query_array(details, '$.sections[*].translation[*]'), '[]'::jsonb),
+				'["string"]'), 'C')
+		) STORED;
+
+		CREATE INDEX IF NOT EXISTS idx_analyses_search_vector ON analyses USING GIN(search_vector);
+	`
+	_, err = DB.Exec(addAnalysesSearchVectorCmd)
+	if err != nil {
+		log.Fatalf("Error adding search_vector to analyses table: %v", err)
+	}
+
+	// Verse IDs are assigned in canonical order when a book is imported, so a
+	// passage is the inclusive range of verse IDs between start and end.
+	createAnalysisPassagesTableCmd := `
+		CREATE TABLE IF NOT EXISTS analysis_passages (
+			id SERIAL PRIMARY KEY,
+			analysis_id INTEGER NOT NULL REFERENCES analyses(id) ON DELETE CASCADE,
+			start_verse_id INTEGER NOT NULL REFERENCES verses(id),
+			end_verse_id INTEGER NOT NULL REFERENCES verses(id),
+			CHECK (start_verse_id <= end_verse_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_analysis_passages_analysis_id ON analysis_passages(analysis_id);
+		CREATE INDEX IF NOT EXISTS idx_analysis_passages_verses ON analysis_passages(start_verse_id, end_verse_id);
+
+		ALTER TABLE analyses ADD COLUMN IF NOT EXISTS passages_backfilled BOOLEAN NOT NULL DEFAULT FALSE;
+	`
+	_, err = DB.Exec(createAnalysisPassagesTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating analysis_passages table: %v", err)
+	}
+
+	// Templates without a user_id are shared with everyone.
+	createAnalysisTemplatesTableCmd := `
+		CREATE TABLE IF NOT EXISTS analysis_templates (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			settings JSONB NOT NULL,
+			source_analysis_id INTEGER REFERENCES analyses(id) ON DELETE SET NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_analysis_templates_user_id ON analysis_templates(user_id);
+
+		ALTER TABLE analyses ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES analyses(id) ON DELETE SET NULL;
+		ALTER TABLE analyses ADD COLUMN IF NOT EXISTS template_id INTEGER REFERENCES analysis_templates(id) ON DELETE SET NULL;
+	`
+	_, err = DB.Exec(createAnalysisTemplatesTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating analysis_templates table: %v", err)
+	}
+
+	// Deleted analyses stay in the trash until the purger removes them.
+	addAnalysesDeletedAtCmd := `
+		ALTER TABLE analyses ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+		CREATE INDEX IF NOT EXISTS idx_analyses_deleted_at ON analyses(deleted_at) WHERE deleted_at IS NOT NULL;
+	`
+	_, err = DB.Exec(addAnalysesDeletedAtCmd)
+	if err != nil {
+		log.Fatalf("Error adding deleted_at to analyses table: %v", err)
+	}
+
+	createUserWorkspacesTableCmd := `
+		CREATE TABLE IF NOT EXISTS user_workspaces (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			last_analysis_id INTEGER REFERENCES analyses(id) ON DELETE SET NULL,
+			open_tabs INTEGER[] NOT NULL DEFAULT '{}',
+			layout_preset VARCHAR(50) NOT NULL DEFAULT '',
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+	_, err = DB.Exec(createUserWorkspacesTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating user_workspaces table: %v", err)
+	}
+
+	// Personal access tokens are stored as SHA-256 hashes; the prefix only
+	// helps users tell them apart.
+	createPersonalAccessTokensTableCmd := `
+		CREATE TABLE IF NOT EXISTS personal_access_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			prefix VARCHAR(16) NOT NULL,
+			scopes TEXT[] NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			last_used_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
+	`
+	_, err = DB.Exec(createPersonalAccessTokensTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating personal_access_tokens table: %v", err)
+	}
+
+	addUsersRoleCmd := `
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user'
+			CHECK (role IN ('user', 'teacher', 'admin'));
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP WITH TIME ZONE;
+	`
+	_, err = DB.Exec(addUsersRoleCmd)
+	if err != nil {
+		log.Fatalf("Error adding role to users table: %v", err)
+	}
+
+	createUserPreferencesTableCmd := `
+		CREATE TABLE IF NOT EXISTS user_preferences (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			preferences JSONB NOT NULL DEFAULT '{}',
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+	_, err = DB.Exec(createUserPreferencesTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating user_preferences table: %v", err)
+	}
+
+	// profile_refreshed_at is when the profile was last taken from the ID
+	// token or userinfo endpoint, rather than from access token claims.
+	addUsersProfileRefreshedAtCmd := `
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_refreshed_at TIMESTAMP WITH TIME ZONE;
+	`
+	_, err = DB.Exec(addUsersProfileRefreshedAtCmd)
+	if err != nil {
+		log.Fatalf("Error adding profile_refreshed_at to users table: %v", err)
+	}
+
+	// Folders are per user: each user files the analyses they can open into
+	// their own folders. Analyses used to carry a single folder_id, which is
+	// moved here, into the folder owner's filing, and dropped.
+	createUserAnalysisFoldersTableCmd := `
+		CREATE TABLE IF NOT EXISTS user_analysis_folders (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			analysis_id INTEGER NOT NULL REFERENCES analyses(id) ON DELETE CASCADE,
+			folder_id INTEGER NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+			PRIMARY KEY (user_id, analysis_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_user_analysis_folders_folder_id ON user_analysis_folders(folder_id);
+
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_name = 'analyses' AND column_name = 'folder_id') THEN
+				INSERT INTO user_analysis_folders (user_id, analysis_id, folder_id)
+				SELECT f.user_id, a.id, f.id
+				FROM analyses a JOIN folders f ON f.id = a.folder_id
+				ON CONFLICT DO NOTHING;
+
+				ALTER TABLE analyses DROP COLUMN folder_id;
+			END IF;
+		END
+		$$;
+	`
+	_, err = DB.Exec(createUserAnalysisFoldersTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating user_analysis_folders table: %v", err)
+	}
+
+	// The owner of an analysis is analyses.user_id. Members used to be able to
+	// be made owners too; they become editors.
+	restrictAnalysisMemberRolesCmd := `
+		UPDATE analysis_members SET role = 'editor' WHERE role = 'owner';
+
+		ALTER TABLE analysis_members DROP CONSTRAINT IF EXISTS analysis_members_grantable_role;
+		ALTER TABLE analysis_members ADD CONSTRAINT analysis_members_grantable_role CHECK (role IN ('editor', 'viewer'));
+	`
+	_, err = DB.Exec(restrictAnalysisMemberRolesCmd)
+	if err != nil {
+		log.Fatalf("Error restricting analysis member roles: %v", err)
+	}
+
+	createSchemaVersionTableCmd := `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+			version INTEGER NOT NULL,
+			migrated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+	_, err = DB.Exec(createSchemaVersionTableCmd)
+	if err != nil {
+		log.Fatalf("Error creating schema_version table: %v", err)
+	}
+
+	// An older binary migrating after a newer one must not lower the version.
+	_, err = DB.Exec(
+		`INSERT INTO schema_version (version) VALUES ($1)
+		ON CONFLICT (id) DO UPDATE SET
+			version = GREATEST(schema_version.version, EXCLUDED.version),
+			migrated_at = CURRENT_TIMESTAMP`,
+		SchemaVersion,
+	)
+	if err != nil {
+		log.Fatalf("Error recording schema version: %v", err)
+	}
+
+	slog.Info("Database migrations completed", "schemaVersion", SchemaVersion)
 }
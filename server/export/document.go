@@ -0,0 +1,313 @@
+// Package export renders analyses into documents for printing and sharing.
+// Every format renders from the same typed Document, which is decoded from the
+// free-form details JSON the frontend saves.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+)
+
+type Document struct {
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	UpdatedAt       string    `json:"updatedAt"`
+	LineSpacing     float64   `json:"lineSpacing"`
+	ShowTranslation bool      `json:"showTranslation"`
+	SplitPosition   float64   `json:"splitPosition"`
+	Sections        []Section `json:"sections"`
+
+	// GreekFontSize is the reader's preferred Greek size in CSS pixels, or
+	// zero for the format's default.
+	GreekFontSize float64 `json:"-"`
+}
+
+type Section struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Words       []Word      `json:"words"`
+	Phrases     []Phrase    `json:"phrases"`
+	Translation Translation `json:"translation"`
+}
+
+// Translation holds one entry per verse. Older analyses saved a single string,
+// which decodes as a one-entry translation.
+type Translation []string
+
+func (t *Translation) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if text == "" {
+			*t = nil
+		} else {
+			*t = Translation{text}
+		}
+		return nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return err
+	}
+
+	*t = lines
+	return nil
+}
+
+type Word struct {
+	ID                 int      `json:"id"`
+	Text               string   `json:"text"`
+	Parsing            *Parsing `json:"parsing,omitempty"`
+	Label              string   `json:"label,omitempty"`
+	LexicalForm        string   `json:"lexicalForm,omitempty"`
+	GlossaryDefinition string   `json:"glossaryDefinition,omitempty"`
+	Strongs            string   `json:"strongs,omitempty"`
+
+	// fullParsing spells the parsing out instead of abbreviating it.
+	fullParsing bool
+}
+
+type Parsing struct {
+	PartOfSpeech string `json:"partOfSpeech"`
+	Person       string `json:"person,omitempty"`
+	Number       string `json:"number,omitempty"`
+	Tense        string `json:"tense,omitempty"`
+	Voice        string `json:"voice,omitempty"`
+	Mood         string `json:"mood,omitempty"`
+	Case         string `json:"case,omitempty"`
+	Gender       string `json:"gender,omitempty"`
+	Degree       string `json:"degree,omitempty"`
+	Type         string `json:"type,omitempty"`
+}
+
+// Phrase groups a run of words within a section, from StartWordID to EndWordID inclusive.
+type Phrase struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	StartWordID int    `json:"startWordId"`
+	EndWordID   int    `json:"endWordId"`
+}
+
+// NewDocument decodes an analysis into a Document, filling in the layout
+// defaults the editor uses when a setting was never saved.
+func NewDocument(analysis service.Analysis) (Document, error) {
+	doc := Document{
+		Title:         analysis.Title,
+		Description:   analysis.Description,
+		UpdatedAt:     analysis.UpdatedAt,
+		LineSpacing:   service.DefaultLineSpacing,
+		SplitPosition: service.DefaultSplitPosition,
+	}
+
+	detailsJSON, err := json.Marshal(analysis.Details)
+	if err != nil {
+		return doc, fmt.Errorf("error marshalling analysis details: %w", err)
+	}
+
+	if err := json.Unmarshal(detailsJSON, &doc); err != nil {
+		return doc, fmt.Errorf("error decoding analysis details: %w", err)
+	}
+
+	// The details do not carry these, so restore them after decoding.
+	doc.Title = analysis.Title
+	doc.Description = analysis.Description
+	doc.UpdatedAt = analysis.UpdatedAt
+
+	if doc.LineSpacing <= 0 {
+		doc.LineSpacing = service.DefaultLineSpacing
+	}
+	if doc.SplitPosition <= 0 || doc.SplitPosition >= 100 {
+		doc.SplitPosition = service.DefaultSplitPosition
+	}
+
+	return doc, nil
+}
+
+// ApplyPreferences renders the document the way the reader prefers: parsing
+// abbreviated or spelled out, and Greek at their font size.
+func (d *Document) ApplyPreferences(preferences service.Preferences) {
+	d.GreekFontSize = float64(preferences.GreekFontSize)
+
+	fullParsing := preferences.ParsingLabels == service.ParsingLabelsFull
+	for i := range d.Sections {
+		for j := range d.Sections[i].Words {
+			d.Sections[i].Words[j].fullParsing = fullParsing
+		}
+	}
+}
+
+// isSet reports whether a parsing value was chosen; the editor stores "none" for cleared fields.
+func isSet(value string) bool {
+	return value != "" && value != "none"
+}
+
+// HasParsing reports whether the word has been parsed.
+func (w Word) HasParsing() bool {
+	return w.Parsing != nil && isSet(w.Parsing.PartOfSpeech)
+}
+
+// ParsingLabel returns the word's parsing as the reader prefers it, or "" if
+// the word has not been parsed.
+func (w Word) ParsingLabel() string {
+	if !w.HasParsing() {
+		return ""
+	}
+	if w.fullParsing {
+		return w.Parsing.Summary()
+	}
+
+	return w.Parsing.Abbreviation()
+}
+
+// Summary returns the parsing spelled out, e.g. "verb present active indicative 3rd singular".
+func (p Parsing) Summary() string {
+	var parts []string
+	for _, value := range p.ordered() {
+		if isSet(value) {
+			parts = append(parts, value)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+var parsingAbbreviations = map[string]string{
+	// Parts of speech
+	"article":     "T",
+	"noun":        "N",
+	"pronoun":     "P",
+	"adjective":   "A",
+	"adverb":      "ADV",
+	"verb":        "V",
+	"preposition": "PREP",
+	"conjunction": "CONJ",
+	"particle":    "PRT",
+
+	// Tense
+	"present":    "P",
+	"imperfect":  "I",
+	"future":     "F",
+	"aorist":     "A",
+	"perfect":    "R",
+	"pluperfect": "L",
+
+	// Voice
+	"active":  "A",
+	"middle":  "M",
+	"passive": "P",
+
+	// Mood
+	"indicative":  "I",
+	"subjunctive": "S",
+	"imperative":  "M",
+	"infinitive":  "N",
+	"participle":  "P",
+	"optative":    "O",
+
+	// Person
+	"1st": "1",
+	"2nd": "2",
+	"3rd": "3",
+
+	// Case
+	"nominative": "N",
+	"genitive":   "G",
+	"dative":     "D",
+	"accusative": "A",
+	"vocative":   "V",
+
+	// Number
+	"singular": "S",
+	"plural":   "P",
+
+	// Gender
+	"masculine": "M",
+	"feminine":  "F",
+	"neuter":    "N",
+
+	// Degree
+	"positive":    "",
+	"comparative": "C",
+	"superlative": "S",
+}
+
+// Abbreviation returns a compact, Robinson-style parsing code, e.g. "V-PAI-3S" or "N-GSF".
+func (p Parsing) Abbreviation() string {
+	if !isSet(p.PartOfSpeech) {
+		return ""
+	}
+
+	abbr := func(values ...string) string {
+		var b strings.Builder
+		for _, value := range values {
+			if isSet(value) {
+				b.WriteString(parsingAbbreviations[strings.ToLower(value)])
+			}
+		}
+		return b.String()
+	}
+
+	groups := []string{abbr(p.PartOfSpeech)}
+	switch strings.ToLower(p.PartOfSpeech) {
+	case "verb":
+		groups = append(groups, abbr(p.Tense, p.Voice, p.Mood))
+		if strings.ToLower(p.Mood) == "participle" {
+			groups = append(groups, abbr(p.Case, p.Number, p.Gender))
+		} else {
+			groups = append(groups, abbr(p.Person, p.Number))
+		}
+	case "pronoun":
+		groups = append(groups, abbr(p.Person, p.Case, p.Number, p.Gender))
+	default:
+		groups = append(groups, abbr(p.Case, p.Number, p.Gender, p.Degree))
+	}
+
+	var nonEmpty []string
+	for _, group := range groups {
+		if group != "" {
+			nonEmpty = append(nonEmpty, group)
+		}
+	}
+
+	return strings.Join(nonEmpty, "-")
+}
+
+func (p Parsing) ordered() []string {
+	return []string{
+		p.PartOfSpeech,
+		p.Type,
+		p.Tense,
+		p.Voice,
+		p.Mood,
+		p.Person,
+		p.Case,
+		p.Number,
+		p.Gender,
+		p.Degree,
+	}
+}
+
+// PhraseFor returns the first phrase in the section covering the word, if any.
+func (s Section) PhraseFor(wordID int) (Phrase, bool) {
+	for _, phrase := range s.Phrases {
+		if wordID >= phrase.StartWordID && wordID <= phrase.EndWordID {
+			return phrase, true
+		}
+	}
+
+	return Phrase{}, false
+}
+
+// PhraseLabel returns the name shown for a phrase, falling back to its type.
+func (p Phrase) PhraseLabel() string {
+	if p.Name != "" {
+		return p.Name
+	}
+
+	return p.Type
+}
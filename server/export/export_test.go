@@ -0,0 +1,83 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixture is the document every format's golden file is rendered from. It has
+// two sections so section headings show, parsed and unparsed words, phrases
+// and a translation of more than one verse.
+func fixture() Document {
+	return Document{
+		Title:           "John 1:1-2",
+		Description:     "The Word | in the beginning",
+		UpdatedAt:       "2024-03-01T12:00:00Z",
+		LineSpacing:     service.DefaultLineSpacing,
+		ShowTranslation: true,
+		SplitPosition:   60,
+		Sections: []Section{
+			{
+				ID:   1,
+				Name: "Verse 1",
+				Words: []Word{
+					{ID: 1, Text: "Ἐν", Parsing: &Parsing{PartOfSpeech: "preposition"}, LexicalForm: "ἐν"},
+					{ID: 2, Text: "ἀρχῇ", Label: "time", Parsing: &Parsing{PartOfSpeech: "noun", Case: "dative", Number: "singular", Gender: "feminine"}, LexicalForm: "ἀρχή"},
+					{ID: 3, Text: "ἦν", Parsing: &Parsing{PartOfSpeech: "verb", Tense: "imperfect", Voice: "active", Mood: "indicative", Person: "3rd", Number: "singular"}, LexicalForm: "εἰμί"},
+					{ID: 4, Text: "ὁ", Parsing: &Parsing{PartOfSpeech: "article", Case: "nominative", Number: "singular", Gender: "masculine"}},
+					{ID: 5, Text: "λόγος", Label: "subject", Parsing: &Parsing{PartOfSpeech: "noun", Case: "nominative", Number: "singular", Gender: "masculine"}, LexicalForm: "λόγος"},
+					{ID: 6, Text: "καὶ", Parsing: &Parsing{PartOfSpeech: "none"}},
+				},
+				Phrases: []Phrase{
+					{ID: "p1", Type: "prepositional", Color: "#1e90ff", StartWordID: 1, EndWordID: 2},
+					{ID: "p2", Type: "nominal", Name: "the Word", Color: "not a color", StartWordID: 4, EndWordID: 5},
+				},
+				Translation: Translation{"In the beginning was the Word,", "", "and the Word was with God."},
+			},
+			{
+				ID:    2,
+				Name:  "Verse 2",
+				Words: []Word{{ID: 1, Text: "οὗτος"}, {ID: 2, Text: "ἦν"}, {ID: 3, Text: "ἐν"}, {ID: 4, Text: "ἀρχῇ"}},
+			},
+		},
+	}
+}
+
+// checkGolden renders the fixture in the named format and compares the result
+// with testdata/fixture.<extension> byte for byte. Run the tests with -update
+// to rewrite the golden file after an intended change.
+func checkGolden(t *testing.T, name string) {
+	t.Helper()
+
+	format, ok := LookupFormat(name)
+	if !ok {
+		t.Fatalf("format %q is not registered", name)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Render(&buf, fixture()); err != nil {
+		t.Fatalf("rendering %s: %v", name, err)
+	}
+
+	golden := filepath.Join("testdata", "fixture."+format.Extension)
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading golden file: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("%s output differs from %s; run go test ./server/export -update if the change is intended", name, golden)
+	}
+}
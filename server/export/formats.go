@@ -0,0 +1,38 @@
+package export
+
+import (
+	"io"
+	"sort"
+)
+
+// Format is an output format an analysis can be exported to.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	Render      func(w io.Writer, doc Document) error
+}
+
+var formats = map[string]Format{
+	"pdf":  {Name: "pdf", ContentType: "application/pdf", Extension: "pdf", Render: RenderPDF},
+	"md":   {Name: "md", ContentType: "text/markdown; charset=utf-8", Extension: "md", Render: RenderMarkdown},
+	"tex":  {Name: "tex", ContentType: "application/x-tex; charset=utf-8", Extension: "tex", Render: RenderLaTeX},
+	"html": {Name: "html", ContentType: "text/html; charset=utf-8", Extension: "html", Render: RenderHTML},
+}
+
+// LookupFormat returns the format registered under name, e.g. "md".
+func LookupFormat(name string) (Format, bool) {
+	format, ok := formats[name]
+	return format, ok
+}
+
+// FormatNames lists the supported format names in sorted order.
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,92 @@
+package export
+
+import (
+	"html/template"
+	"io"
+)
+
+var htmlTemplate = template.Must(template.New("analysis").Funcs(template.FuncMap{
+	"annotations": wordAnnotations,
+	"phraseText":  phraseText,
+	"phraseFor": func(section Section, word Word) *Phrase {
+		if phrase, ok := section.PhraseFor(word.ID); ok {
+			return &phrase
+		}
+		return nil
+	},
+	"css": func(value string) template.CSS {
+		if _, _, _, ok := parseHexColor(value); ok {
+			return template.CSS(value)
+		}
+		return template.CSS("#000000")
+	},
+	"sub": func(a, b float64) float64 { return a - b },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: "Times New Roman", serif; margin: 2rem; color: #222; }
+  .greek { font-family: "SBL BibLit", "SBL Greek", "Gentium Plus", serif; line-height: {{.LineSpacing}}; }
+  .word { display: inline-block; vertical-align: top; margin: 0 0.4em 0.6em 0; }
+  .word .text { font-size: {{if .GreekFontSize}}{{.GreekFontSize}}px{{else}}1.3rem{{end}}; }
+  .word .note { display: block; font-size: 0.7rem; color: #555; line-height: 1.3; }
+  .phrase .text { border-bottom: 2px solid; }
+  .section { margin-bottom: 2rem; }
+  .split { display: flex; gap: 1.5rem; }
+  .translation p { margin: 0 0 0.5rem; }
+  .phrases { font-size: 0.85rem; }
+</style>
+</head>
+<body>
+{{- $doc := . }}
+{{- if .Title}}
+<h1>{{.Title}}</h1>
+{{- end}}
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- range .Sections}}
+{{- $section := .}}
+<div class="section">
+{{- if and .Name (gt (len $doc.Sections) 1)}}
+<h2>{{.Name}}</h2>
+{{- end}}
+<div{{if $doc.ShowTranslation}} class="split"{{end}}>
+<div class="greek"{{if $doc.ShowTranslation}} style="width: {{$doc.SplitPosition}}%"{{end}}>
+{{- range .Words}}
+{{- $phrase := phraseFor $section .}}
+<span class="word{{if $phrase}} phrase{{end}}"{{if $phrase}} title="{{$phrase.PhraseLabel}}" style="color: {{css $phrase.Color}}"{{end}}><span class="text">{{.Text}}</span>
+{{- range annotations .}}<span class="note">{{.}}</span>{{end -}}
+</span>
+{{- end}}
+</div>
+{{- if .Translation}}
+<div class="translation"{{if $doc.ShowTranslation}} style="width: {{sub 100 $doc.SplitPosition}}%"{{end}}>
+{{- range .Translation}}
+{{- if .}}
+<p>{{.}}</p>
+{{- end}}
+{{- end}}
+</div>
+{{- end}}
+</div>
+{{- if .Phrases}}
+<ul class="phrases">
+{{- range .Phrases}}
+<li><span style="color: {{css .Color}}">{{.PhraseLabel}}</span>: {{phraseText $section .}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</div>
+{{- end}}
+</body>
+</html>
+`))
+
+// RenderHTML writes the document as a standalone HTML page that mirrors the
+// editor layout, including the translation split when it is shown.
+func RenderHTML(w io.Writer, doc Document) error {
+	return htmlTemplate.Execute(w, doc)
+}
@@ -0,0 +1,7 @@
+package export
+
+import "testing"
+
+func TestRenderHTMLGolden(t *testing.T) {
+	checkGolden(t, "html")
+}
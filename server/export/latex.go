@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const latexPreamble = `\documentclass{article}
+\usepackage{fontspec}
+\setmainfont{SBL BibLit}
+\usepackage{xcolor}
+\usepackage{expex}
+\lingset{glhangstyle=none}
+
+`
+
+// RenderLaTeX writes the document as a XeLaTeX/LuaLaTeX source using expex
+// glosses: one example per section with the Greek, its annotations and the
+// translation as the free translation line.
+func RenderLaTeX(w io.Writer, doc Document) error {
+	b := bufio.NewWriter(w)
+
+	b.WriteString(latexPreamble)
+	if doc.Title != "" {
+		fmt.Fprintf(b, "\\title{%s}\n\\date{}\n", latexEscape(doc.Title))
+	}
+	b.WriteString("\\begin{document}\n")
+	if doc.Title != "" {
+		b.WriteString("\\maketitle\n")
+	}
+	if doc.Description != "" {
+		fmt.Fprintf(b, "\n%s\n", latexEscape(doc.Description))
+	}
+
+	for _, section := range doc.Sections {
+		if section.Name != "" && len(doc.Sections) > 1 {
+			fmt.Fprintf(b, "\n\\section*{%s}\n", latexEscape(section.Name))
+		}
+		if len(section.Words) == 0 {
+			continue
+		}
+
+		b.WriteString("\n\\ex\n\\begingl\n")
+
+		greek := make([]string, len(section.Words))
+		for i, word := range section.Words {
+			greek[i] = latexWord(section, word)
+		}
+		fmt.Fprintf(b, "\\gla %s //\n", strings.Join(greek, " "))
+
+		// Each annotation gets its own aligned \glb line under the Greek.
+		for _, line := range interlinearLines {
+			if !anyWord(section.Words, line.value) {
+				continue
+			}
+
+			values := make([]string, len(section.Words))
+			for i, word := range section.Words {
+				values[i] = latexGlossItem(line.value(word))
+			}
+			fmt.Fprintf(b, "\\glb %s //\n", strings.Join(values, " "))
+		}
+
+		if translation := translationText(section); translation != "" {
+			fmt.Fprintf(b, "\\glft %s //\n", latexEscape(translation))
+		}
+
+		b.WriteString("\\endgl\n\\xe\n")
+	}
+
+	b.WriteString("\n\\end{document}\n")
+	return b.Flush()
+}
+
+// latexWord renders a Greek word, colored by its phrase if it has one.
+func latexWord(section Section, word Word) string {
+	text := latexGlossItem(word.Text)
+	if phrase, ok := section.PhraseFor(word.ID); ok {
+		if color := strings.TrimPrefix(phrase.Color, "#"); len(color) == 6 {
+			return fmt.Sprintf("{\\textcolor[HTML]{%s}%s}", strings.ToUpper(color), text)
+		}
+	}
+
+	return text
+}
+
+// latexGlossItem escapes a gloss token, grouping it so spaces do not split it
+// and empty values still hold their place.
+func latexGlossItem(value string) string {
+	return "{" + latexEscape(value) + "}"
+}
+
+func latexEscape(text string) string {
+	return strings.NewReplacer(
+		`\`, `\textbackslash{}`,
+		"{", `\{`,
+		"}", `\}`,
+		"$", `\$`,
+		"&", `\&`,
+		"#", `\#`,
+		"^", `\textasciicircum{}`,
+		"_", `\_`,
+		"~", `\textasciitilde{}`,
+		"%", `\%`,
+		"/", `\slash{}`,
+		"\n", " ",
+	).Replace(text)
+}
+
+// translationText joins the per-verse translation into one paragraph.
+func translationText(section Section) string {
+	var lines []string
+	for _, line := range section.Translation {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, " ")
+}
@@ -0,0 +1,7 @@
+package export
+
+import "testing"
+
+func TestRenderLaTeXGolden(t *testing.T) {
+	checkGolden(t, "tex")
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// markdownWordsPerTable keeps interlinear tables narrow enough to read in an editor.
+const markdownWordsPerTable = 8
+
+// RenderMarkdown writes the document as Markdown with one interlinear table per
+// run of words: the Greek in the header row, then label, parsing and lexical form.
+func RenderMarkdown(w io.Writer, doc Document) error {
+	b := bufio.NewWriter(w)
+
+	if doc.Title != "" {
+		fmt.Fprintf(b, "# %s\n\n", markdownEscape(doc.Title))
+	}
+	if doc.Description != "" {
+		fmt.Fprintf(b, "%s\n\n", markdownEscape(doc.Description))
+	}
+
+	for _, section := range doc.Sections {
+		if section.Name != "" && len(doc.Sections) > 1 {
+			fmt.Fprintf(b, "## %s\n\n", markdownEscape(section.Name))
+		}
+
+		for start := 0; start < len(section.Words); start += markdownWordsPerTable {
+			end := min(start+markdownWordsPerTable, len(section.Words))
+			writeMarkdownTable(b, section, section.Words[start:end])
+		}
+
+		if len(section.Phrases) > 0 {
+			b.WriteString("**Phrases**\n\n")
+			for _, phrase := range section.Phrases {
+				fmt.Fprintf(b, "- %s: %s\n", markdownEscape(phrase.PhraseLabel()), markdownEscape(phraseText(section, phrase)))
+			}
+			b.WriteString("\n")
+		}
+
+		if translationText(section) != "" {
+			b.WriteString("**Translation**\n\n")
+			var quoted []string
+			for _, line := range section.Translation {
+				if strings.TrimSpace(line) != "" {
+					quoted = append(quoted, "> "+markdownEscape(line))
+				}
+			}
+			b.WriteString(strings.Join(quoted, "\n>\n") + "\n\n")
+		}
+	}
+
+	return b.Flush()
+}
+
+func writeMarkdownTable(b *bufio.Writer, section Section, words []Word) {
+	cells := func(value func(Word) string) string {
+		values := make([]string, len(words))
+		for i, word := range words {
+			values[i] = markdownEscape(value(word))
+		}
+		return "| " + strings.Join(values, " | ") + " |\n"
+	}
+
+	b.WriteString(cells(func(word Word) string {
+		if phrase, ok := section.PhraseFor(word.ID); ok {
+			return "**" + word.Text + "**<sup>" + phrase.PhraseLabel() + "</sup>"
+		}
+		return word.Text
+	}))
+	b.WriteString("|" + strings.Repeat(" --- |", len(words)) + "\n")
+
+	for _, line := range interlinearLines {
+		if !anyWord(words, line.value) {
+			continue
+		}
+		b.WriteString(cells(line.value))
+	}
+	b.WriteString("\n")
+}
+
+func markdownEscape(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(text)
+}
+
+// interlinearLines are the annotation lines shown under the Greek in tabular formats.
+var interlinearLines = []struct {
+	name  string
+	value func(Word) string
+}{
+	{"label", func(word Word) string { return word.Label }},
+	{"parsing", Word.ParsingLabel},
+	{"lexical", func(word Word) string { return word.LexicalForm }},
+}
+
+func anyWord(words []Word, value func(Word) string) bool {
+	for _, word := range words {
+		if value(word) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// phraseText joins the Greek words a phrase covers.
+func phraseText(section Section, phrase Phrase) string {
+	var words []string
+	for _, word := range section.Words {
+		if word.ID >= phrase.StartWordID && word.ID <= phrase.EndWordID {
+			words = append(words, word.Text)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
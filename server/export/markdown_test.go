@@ -0,0 +1,7 @@
+package export
+
+import "testing"
+
+func TestRenderMarkdownGolden(t *testing.T) {
+	checkGolden(t, "md")
+}
@@ -0,0 +1,300 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/frontend"
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	pdfFont = "SBLBibLit"
+
+	pageMargin       = 15.0 // mm
+	columnGap        = 6.0  // mm
+	wordGap          = 3.0  // mm
+	defaultGreekSize = 15.0 // pt
+	annotateSize     = 7.0  // pt
+	textSize         = 10.0 // pt
+	ptToMM           = 25.4 / 72
+	pxToPt           = 72.0 / 96
+)
+
+// pdfEpoch is stamped into every PDF so identical analyses render byte-for-byte identical files.
+var pdfEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// RenderPDF writes the document as an interlinear PDF: each Greek word with its
+// label, parsing and lexical form underneath, phrases underlined in their color,
+// and, when the analysis shows it, the translation in a column to the right.
+func RenderPDF(w io.Writer, doc Document) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetCreationDate(pdfEpoch)
+	pdf.SetModificationDate(pdfEpoch)
+	pdf.SetCatalogSort(true)
+	pdf.SetCompression(true)
+	pdf.SetTitle(doc.Title, true)
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(false, pageMargin)
+	pdf.AddUTF8FontFromBytes(pdfFont, "", frontend.SBLBibLit)
+
+	r := &pdfRenderer{pdf: pdf, doc: doc}
+	r.render()
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("error rendering pdf: %w", err)
+	}
+
+	return pdf.Output(w)
+}
+
+type pdfRenderer struct {
+	pdf *fpdf.Fpdf
+	doc Document
+}
+
+// column tracks a write position that can flow onto following pages
+// independently of other columns.
+type column struct {
+	x, w float64
+	page int
+	y    float64
+}
+
+func (r *pdfRenderer) render() {
+	r.pdf.AddPage()
+
+	full := &column{x: pageMargin, w: r.contentWidth(), page: 1, y: pageMargin}
+
+	if r.doc.Title != "" {
+		r.writeText(full, r.doc.Title, 18, 0)
+	}
+	if r.doc.Description != "" {
+		r.writeText(full, r.doc.Description, textSize, 100)
+	}
+	full.y += 4
+
+	for _, section := range r.doc.Sections {
+		if section.Name != "" && len(r.doc.Sections) > 1 {
+			r.writeText(full, section.Name, 12, 0)
+		}
+
+		if !r.doc.ShowTranslation {
+			r.writeWords(full, section)
+			full.y += 6
+			continue
+		}
+
+		greekWidth := (r.contentWidth() - columnGap) * r.doc.SplitPosition / 100
+		greek := &column{x: pageMargin, w: greekWidth, page: full.page, y: full.y}
+		translation := &column{
+			x:    pageMargin + greekWidth + columnGap,
+			w:    r.contentWidth() - greekWidth - columnGap,
+			page: full.page,
+			y:    full.y,
+		}
+
+		r.writeWords(greek, section)
+		for _, line := range section.Translation {
+			r.writeText(translation, line, textSize, 0)
+			translation.y += 2
+		}
+
+		*full = *lowest(greek, translation)
+		full.x, full.w = pageMargin, r.contentWidth()
+		full.y += 6
+	}
+}
+
+// writeWords lays the words of a section out as interlinear blocks, wrapping
+// to the next row when the column is full.
+func (r *pdfRenderer) writeWords(col *column, section Section) {
+	greekHeight := r.greekSize() * ptToMM * 1.2
+	annotateHeight := annotateSize * ptToMM * 1.3
+	rowGap := r.doc.LineSpacing * 2
+
+	x := col.x
+	var row []Word
+
+	flush := func() {
+		if len(row) == 0 {
+			return
+		}
+
+		lines := 0
+		for _, word := range row {
+			lines = max(lines, len(wordAnnotations(word)))
+		}
+		height := greekHeight + float64(lines)*annotateHeight
+
+		r.reserve(col, height)
+		wx := col.x
+		for _, word := range row {
+			wx = r.writeWord(section, word, wx, col.y, greekHeight, annotateHeight)
+		}
+
+		col.y += height + rowGap
+		row = row[:0]
+		x = col.x
+	}
+
+	for _, word := range section.Words {
+		width := r.wordWidth(word)
+		if x+width > col.x+col.w && len(row) > 0 {
+			flush()
+		}
+		row = append(row, word)
+		x += width + wordGap
+	}
+	flush()
+}
+
+// writeWord draws one word block at (x, y) and returns where the next block starts.
+func (r *pdfRenderer) writeWord(section Section, word Word, x, y, greekHeight, annotateHeight float64) float64 {
+	pdf := r.pdf
+	width := r.wordWidth(word)
+
+	pdf.SetFont(pdfFont, "", r.greekSize())
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetXY(x, y)
+	pdf.CellFormat(width, greekHeight, word.Text, "", 0, "L", false, 0, "")
+
+	if phrase, ok := section.PhraseFor(word.ID); ok {
+		red, green, blue := hexColor(phrase.Color)
+		pdf.SetDrawColor(red, green, blue)
+		pdf.SetLineWidth(0.6)
+		// Extend the underline across the gap so a phrase reads as one run.
+		end := x + width
+		if next, ok := section.PhraseFor(word.ID + 1); ok && next.ID == phrase.ID {
+			end += wordGap
+		}
+		pdf.Line(x, y+greekHeight-0.5, end, y+greekHeight-0.5)
+	}
+
+	pdf.SetFont(pdfFont, "", annotateSize)
+	pdf.SetTextColor(80, 80, 80)
+	ay := y + greekHeight
+	for _, annotation := range wordAnnotations(word) {
+		pdf.SetXY(x, ay)
+		pdf.CellFormat(width, annotateHeight, annotation, "", 0, "L", false, 0, "")
+		ay += annotateHeight
+	}
+
+	return x + width + wordGap
+}
+
+// writeText writes wrapped text into the column. A positive limit truncates the
+// text to that many characters first.
+func (r *pdfRenderer) writeText(col *column, text string, size float64, limit int) {
+	if limit > 0 && len([]rune(text)) > limit {
+		text = string([]rune(text)[:limit]) + "…"
+	}
+
+	pdf := r.pdf
+	pdf.SetFont(pdfFont, "", size)
+	pdf.SetTextColor(0, 0, 0)
+	height := size * ptToMM * 1.4
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		for _, line := range pdf.SplitText(paragraph, col.w) {
+			r.reserve(col, height)
+			pdf.SetXY(col.x, col.y)
+			pdf.CellFormat(col.w, height, line, "", 0, "L", false, 0, "")
+			col.y += height
+		}
+	}
+}
+
+// reserve makes sure height fits in the column, moving it to the next page if
+// not, and selects the column's page for drawing.
+func (r *pdfRenderer) reserve(col *column, height float64) {
+	_, pageHeight := r.pdf.GetPageSize()
+	if col.y+height > pageHeight-pageMargin && col.y > pageMargin {
+		col.page++
+		col.y = pageMargin
+	}
+
+	for r.pdf.PageCount() < col.page {
+		r.pdf.AddPage()
+	}
+	r.pdf.SetPage(col.page)
+}
+
+func (r *pdfRenderer) wordWidth(word Word) float64 {
+	pdf := r.pdf
+
+	pdf.SetFont(pdfFont, "", r.greekSize())
+	width := pdf.GetStringWidth(word.Text)
+
+	pdf.SetFont(pdfFont, "", annotateSize)
+	for _, annotation := range wordAnnotations(word) {
+		width = max(width, pdf.GetStringWidth(annotation))
+	}
+
+	return width + 1
+}
+
+// greekSize is the Greek font size in points, from the reader's preference
+// in CSS pixels when they have one.
+func (r *pdfRenderer) greekSize() float64 {
+	if r.doc.GreekFontSize > 0 {
+		return r.doc.GreekFontSize * pxToPt
+	}
+
+	return defaultGreekSize
+}
+
+func (r *pdfRenderer) contentWidth() float64 {
+	pageWidth, _ := r.pdf.GetPageSize()
+	return pageWidth - 2*pageMargin
+}
+
+// wordAnnotations are the lines printed under a word, in display order.
+func wordAnnotations(word Word) []string {
+	var annotations []string
+	if word.Label != "" {
+		annotations = append(annotations, word.Label)
+	}
+	if word.HasParsing() {
+		annotations = append(annotations, word.ParsingLabel())
+	}
+	if word.LexicalForm != "" {
+		annotations = append(annotations, word.LexicalForm)
+	}
+
+	return annotations
+}
+
+func lowest(cols ...*column) *column {
+	low := cols[0]
+	for _, col := range cols[1:] {
+		if col.page > low.page || (col.page == low.page && col.y > low.y) {
+			low = col
+		}
+	}
+
+	return low
+}
+
+// hexColor parses "#rrggbb" or "#rgb", falling back to black.
+func hexColor(color string) (int, int, int) {
+	red, green, blue, _ := parseHexColor(color)
+	return red, green, blue
+}
+
+func parseHexColor(color string) (int, int, int, bool) {
+	color = strings.TrimPrefix(color, "#")
+	if len(color) == 3 {
+		color = string([]byte{color[0], color[0], color[1], color[1], color[2], color[2]})
+	}
+
+	value, err := strconv.ParseUint(color, 16, 32)
+	if err != nil || len(color) != 6 {
+		return 0, 0, 0, false
+	}
+
+	return int(value >> 16 & 0xff), int(value >> 8 & 0xff), int(value & 0xff), true
+}
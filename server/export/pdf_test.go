@@ -0,0 +1,24 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRenderPDFGolden(t *testing.T) {
+	checkGolden(t, "pdf")
+}
+
+func TestRenderPDFIsDeterministic(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := RenderPDF(&first, fixture()); err != nil {
+		t.Fatal(err)
+	}
+	if err := RenderPDF(&second, fixture()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("rendering the same document twice gave different PDFs")
+	}
+}
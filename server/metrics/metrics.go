@@ -0,0 +1,120 @@
+// Package metrics defines the server's Prometheus metrics and serves them.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "greek_study_tool"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time spent in the database by service function.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"function"})
+
+	analysesSaved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "analyses_saved_total",
+		Help:      "Analyses saved, by whether they were created or updated.",
+	}, []string{"operation"})
+
+	autosavePayload = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "autosave_payload_bytes",
+		Help:      "Size of the analysis details saved by each update.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8), // 1KiB to 16MiB
+	})
+
+	lexiconMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lexicon_misses_total",
+		Help:      "Strong's lookups for codes the lexicon does not have.",
+	})
+
+	jwtValidationFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jwt_validation_failures_total",
+		Help:      "Bearer JWTs that failed validation.",
+	})
+)
+
+// Middleware records the count and latency of every request, labelled with
+// the route template rather than the path so IDs do not create new series.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveQuery records the time a service function spent in the database
+// since start. Use it as defer metrics.ObserveQuery("Name", time.Now()).
+func ObserveQuery(function string, start time.Time) {
+	queryDuration.WithLabelValues(function).Observe(time.Since(start).Seconds())
+}
+
+// AnalysisCreated counts a newly created analysis.
+func AnalysisCreated() {
+	analysesSaved.WithLabelValues("create").Inc()
+}
+
+// AnalysisUpdated counts a saved update to an analysis whose details were
+// payloadBytes long.
+func AnalysisUpdated(payloadBytes int) {
+	analysesSaved.WithLabelValues("update").Inc()
+	autosavePayload.Observe(float64(payloadBytes))
+}
+
+// LexiconMiss counts a Strong's code that was not found.
+func LexiconMiss() {
+	lexiconMisses.Inc()
+}
+
+// JWTValidationFailed counts a bearer JWT that failed validation.
+func JWTValidationFailed() {
+	jwtValidationFailures.Inc()
+}
+
+// RegisterDB exports the connection pool stats of db.
+func RegisterDB(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ScopedAuth authenticates like SessionOrJwtAuth and also accepts personal
+// access tokens that were granted scope. Sessions and JWTs carry every scope;
+// routes not behind ScopedAuth cannot be reached with an access token at all.
+func ScopedAuth(idp auth.IdentityProvider, scope string) gin.HandlerFunc {
+	sessionOrJwtAuth := SessionOrJwtAuth(idp)
+
+	return func(ctx *gin.Context) {
+		token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !strings.HasPrefix(token, service.AccessTokenPrefix) {
+			sessionOrJwtAuth(ctx)
+			return
+		}
+
+		user, scopes, err := service.AuthenticateAccessToken(ctx.Request.Context(), token)
+		if errors.Is(err, service.ErrAccessTokenRejected) {
+			apierror.Abort(ctx, apierror.New(http.StatusUnauthorized, "Invalid or expired access token"))
+			return
+		}
+		if err != nil {
+			apierror.Abort(ctx, err)
+			return
+		}
+
+		if !slices.Contains(scopes, scope) {
+			apierror.Abort(ctx, apierror.New(http.StatusForbidden, "Access token is missing the "+scope+" scope"))
+			return
+		}
+
+		if !setActiveUser(ctx, user) {
+			return
+		}
+
+		ctx.Next()
+	}
+}
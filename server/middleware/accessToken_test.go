@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestScopedAuthTokenLookupErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"unknown, expired or revoked token", sql.ErrNoRows, http.StatusUnauthorized},
+		{"database failure", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			previous := database.DB
+			database.DB = db
+			defer func() {
+				database.DB = previous
+				db.Close()
+			}()
+
+			mock.ExpectQuery("FROM personal_access_tokens").WillReturnError(test.err)
+
+			r := gin.New()
+			r.GET("/api/books", ScopedAuth(nil, service.ScopeReadCorpus), func(c *gin.Context) {
+				t.Error("the handler ran")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+			req.Header.Set("Authorization", "Bearer "+service.AccessTokenPrefix+"secret")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, test.status, w.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
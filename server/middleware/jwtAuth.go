@@ -1,40 +1,44 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
 	"strings"
 
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
 	"github.com/ZacharyWM/greek-study-tool/server/auth"
-	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
 	"github.com/gin-gonic/gin"
 )
 
-// JwtAuth is a middleware that will check the validity of our JWT.
-func JwtAuth() gin.HandlerFunc {
-	jwtValidator := auth.GetJwtValidator()
-
+// JwtAuth is a middleware that will check the validity of our JWT against the
+// identity provider and put the user it belongs to on the context.
+func JwtAuth(idp auth.IdentityProvider) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authHeader := ctx.GetHeader("Authorization")
+
+		// Browsers cannot set headers on WebSocket handshakes, so accept the token as a query param there.
+		if authHeader == "" && ctx.IsWebsocket() && ctx.Query("access_token") != "" {
+			authHeader = "Bearer " + ctx.Query("access_token")
+		}
+
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			ctx.JSON(http.StatusUnauthorized, gin.H{"message": "Authorization header missing or invalid"})
-			ctx.Abort()
+			apierror.Abort(ctx, apierror.New(http.StatusUnauthorized, "Authorization header missing or invalid"))
 			return
 		}
 
-		token, err := jwtValidator.ValidateToken(
+		claims, err := idp.ValidateAccessToken(
 			ctx.Request.Context(),
 			strings.TrimPrefix(authHeader, "Bearer "),
 		)
 		if err != nil {
-			log.Printf("encountered error while validating JWT: %v", err)
-			ctx.JSON(http.StatusUnauthorized, gin.H{"message": "Failed to validate JWT"})
-			ctx.Abort()
+			metrics.JWTValidationFailed()
+			apierror.Abort(ctx, apierror.Wrap(err, http.StatusUnauthorized, "Failed to validate JWT"))
 			return
 		}
 
-		claims := token.(*validator.ValidatedClaims)
-		ctx.Set("claims", claims)
+		if !setUser(ctx, claims) {
+			return
+		}
 
 		ctx.Next()
 	}
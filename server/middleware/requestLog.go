@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/logging"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+// RequestID gives every request an ID, reusing the one a proxy put in the
+// X-Request-ID header when it looks sane, and echoes it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		ctx.Request = ctx.Request.WithContext(logging.WithRequestID(ctx.Request.Context(), id))
+		ctx.Header(RequestIDHeader, id)
+
+		ctx.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs every request once it is done, with its route template and
+// the user it was made by. Server errors are logged at error level and client
+// errors at warn level.
+func AccessLog() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", ctx.Request.Method),
+			slog.String("route", ctx.FullPath()),
+			slog.String("path", ctx.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("bytes", ctx.Writer.Size()),
+			slog.String("clientIp", ctx.ClientIP()),
+		}
+		if user, ok := ctx.Get(userKey); ok {
+			attrs = append(attrs, slog.Int("userId", user.(service.User).ID))
+		}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", strings.Join(ctx.Errors.Errors(), "; ")))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		slog.LogAttrs(ctx.Request.Context(), level, "Request", attrs...)
+	}
+}
+
+// Recovery turns a panic in a handler into an internal error response.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(ctx *gin.Context, recovered interface{}) {
+		slog.ErrorContext(ctx.Request.Context(), "Recovered from panic", "panic", recovered, "stack", string(debug.Stack()))
+		apierror.Abort(ctx, fmt.Errorf("panic: %v", recovered))
+	})
+}
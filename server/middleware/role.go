@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets through users with at least the given role. It must
+// come after one of the auth middlewares.
+func RequireRole(role service.UserRole) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !UserFromContext(ctx).Role.AtLeast(role) {
+			apierror.Abort(ctx, apierror.New(http.StatusForbidden, "Requires the "+string(role)+" role"))
+			return
+		}
+
+		ctx.Next()
+	}
+}
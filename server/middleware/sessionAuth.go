@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionOrJwtAuth authenticates API requests either with a bearer token, as
+// JwtAuth does, or with the browser session set up by the login callback.
+// Requests that carry an Authorization header are always treated as bearer
+// requests.
+func SessionOrJwtAuth(idp auth.IdentityProvider) gin.HandlerFunc {
+	jwtAuth := JwtAuth(idp)
+
+	return func(ctx *gin.Context) {
+		if ctx.GetHeader("Authorization") != "" || (ctx.IsWebsocket() && ctx.Query("access_token") != "") {
+			jwtAuth(ctx)
+			return
+		}
+
+		session := sessions.Default(ctx)
+		subject, _ := session.Get(auth.SessionSubject).(string)
+		expiresAt, _ := session.Get(auth.SessionExpiresAt).(int64)
+		if subject == "" || time.Now().Unix() >= expiresAt {
+			apierror.Abort(ctx, apierror.New(http.StatusUnauthorized, "Authorization header or session missing or invalid"))
+			return
+		}
+
+		// The session cookie is sent on cross-site requests too, so refuse
+		// state-changing requests that come from another origin.
+		if !isSafeMethod(ctx.Request.Method) && !sameOrigin(ctx.Request) {
+			apierror.Abort(ctx, apierror.New(http.StatusForbidden, "Cross-origin request rejected"))
+			return
+		}
+
+		if !setUser(ctx, auth.SessionClaims(idp.Issuer(), subject, time.Unix(expiresAt, 0))) {
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sameOrigin reports whether the request's Origin, or its Referer when there
+// is no Origin, is this server.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return u.Host == r.Host
+}
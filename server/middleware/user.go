@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/gin-gonic/gin"
+)
+
+const userKey = "user"
+
+// setUser puts the claims and the user they belong to on the context, creating
+// the user from the token's profile the first time they are seen. It aborts
+// the request and reports false when the user cannot be loaded.
+func setUser(ctx *gin.Context, claims *validator.ValidatedClaims) bool {
+	profile := auth.ProfileFromClaims(claims)
+
+	user, err := service.ProvisionUser(ctx.Request.Context(), service.User{
+		IdpID:         profile.Subject,
+		FirstName:     profile.GivenName,
+		LastName:      profile.FamilyName,
+		Nickname:      profile.Nickname,
+		Name:          profile.Name,
+		Picture:       profile.Picture,
+		Email:         profile.Email,
+		EmailVerified: profile.EmailVerified,
+	})
+	if err != nil {
+		err = fmt.Errorf("error provisioning user %s: %w", profile.Subject, err)
+		apierror.Abort(ctx, apierror.Wrap(err, http.StatusInternalServerError, "Failed to get user"))
+		return false
+	}
+
+	for _, name := range profile.Roles {
+		if role := service.UserRole(name); role.Valid() && !user.Role.AtLeast(role) {
+			user.Role = role
+		}
+	}
+
+	ctx.Set("claims", claims)
+	return setActiveUser(ctx, user)
+}
+
+// setActiveUser puts the user on the context, unless their account is
+// disabled, in which case it aborts the request and reports false.
+func setActiveUser(ctx *gin.Context, user service.User) bool {
+	if user.DisabledAt != nil {
+		apierror.Abort(ctx, apierror.New(http.StatusForbidden, "Account is disabled"))
+		return false
+	}
+
+	ctx.Set(userKey, user)
+	return true
+}
+
+// UserFromContext returns the user an authenticated request belongs to.
+func UserFromContext(ctx *gin.Context) service.User {
+	user, _ := ctx.Get(userKey)
+	return user.(service.User)
+}
@@ -0,0 +1,102 @@
+package realtime
+
+import (
+	"sort"
+	"sync"
+)
+
+// clientBufferSize is how many messages may queue for a client before it is
+// considered too slow and disconnected.
+const clientBufferSize = 64
+
+type MessageType string
+
+const (
+	// Sent by clients
+	MessageSubmit MessageType = "submit"
+
+	// Sent by the server
+	MessageSync     MessageType = "sync"
+	MessageOp       MessageType = "op"
+	MessageAck      MessageType = "ack"
+	MessageReject   MessageType = "reject"
+	MessagePresence MessageType = "presence"
+	MessageError    MessageType = "error"
+)
+
+const (
+	// RejectConflict means another client changed the same target first.
+	RejectConflict = "conflict"
+	// RejectStale means the client is too far behind and must reload the analysis.
+	RejectStale = "stale"
+)
+
+type Message struct {
+	Type     MessageType `json:"type"`
+	Seq      int64       `json:"seq,omitempty"`
+	Op       *Operation  `json:"op,omitempty"`
+	Ops      []Operation `json:"ops,omitempty"`
+	Presence []Presence  `json:"presence,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type Presence struct {
+	ClientID int64  `json:"clientId"`
+	UserID   int    `json:"userId"`
+	Name     string `json:"name"`
+	CanEdit  bool   `json:"canEdit"`
+}
+
+// Client is one connection to an analysis room.
+type Client struct {
+	ID      int64
+	UserID  int
+	Name    string
+	CanEdit bool
+
+	authorize func() (bool, error)
+	send      chan Message
+	room      *room
+	hub       *Hub
+	leaveOnce sync.Once
+}
+
+// Messages returns the channel of messages from the room. It is closed once the
+// client has left or was disconnected for falling behind.
+func (c *Client) Messages() <-chan Message {
+	return c.send
+}
+
+// Submit sends an operation to the room. The result arrives on Messages as an
+// ack, reject or error message. The participant's access is checked here,
+// before the room sees the operation, so the room never waits on it.
+func (c *Client) Submit(op Operation) {
+	s := submission{client: c, op: op}
+	if c.authorize != nil {
+		s.checked = true
+		s.canEdit, s.err = c.authorize()
+	}
+
+	select {
+	case c.room.submit <- s:
+	case <-c.room.done:
+	}
+}
+
+// Leave disconnects the client from the room. It is safe to call more than once.
+func (c *Client) Leave() {
+	c.leaveOnce.Do(func() {
+		select {
+		case c.room.leave <- c:
+		case <-c.room.done:
+		}
+		c.hub.clients.Done()
+	})
+}
+
+func sortPresence(presence []Presence) {
+	sort.Slice(presence, func(i, j int) bool {
+		return presence[i].ClientID < presence[j].ClientID
+	})
+}
@@ -0,0 +1,162 @@
+// Package realtime broadcasts editing operations between everyone who has the
+// same analysis open. Each analysis gets a room goroutine that owns the
+// connected clients and the operation log, so ordering and conflict checks
+// never need locks. Clients are transport agnostic: the WebSocket pumps in
+// websocket.go are one way to drive them, and an in-process caller can use
+// Join, Submit and Messages directly.
+//
+// The operation log only orders concurrent edits; clients still save the
+// analysis through the API. It is kept in memory for as long as the room
+// lives, which is until it has been empty for the hub's idle timeout.
+package realtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultIdleTimeout is how long an empty room keeps its operation log, so
+// clients that lose their connection can reconnect and carry on from the
+// sequence number they had.
+const defaultIdleTimeout = 5 * time.Minute
+
+// ErrNoAccess is returned by a participant's Authorize function when the user
+// can no longer open the analysis.
+var ErrNoAccess = errors.New("no access to the analysis")
+
+// Hub owns one room per analysis with connected clients, or that has only
+// recently emptied.
+type Hub struct {
+	mu          sync.Mutex
+	rooms       map[int]*room
+	nextID      atomic.Int64
+	idleTimeout time.Duration
+
+	// clients counts the clients that have joined and not yet left.
+	clients sync.WaitGroup
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		rooms:       make(map[int]*room),
+		idleTimeout: defaultIdleTimeout,
+	}
+}
+
+// Participant describes who is joining a room.
+//
+// Authorize, when set, is called before each operation the client submits to
+// find out whether the user may still edit. It returns ErrNoAccess when the
+// user has lost access altogether, which disconnects the client; other errors
+// reject the operation. Without it, CanEdit holds for the whole connection.
+type Participant struct {
+	UserID    int
+	Name      string
+	CanEdit   bool
+	Authorize func() (canEdit bool, err error)
+}
+
+// Join connects a new client to the analysis room, starting the room if needed.
+// The caller must call Leave when the client goes away.
+func (h *Hub) Join(analysisID int, p Participant) *Client {
+	client := &Client{
+		ID:        h.nextID.Add(1),
+		UserID:    p.UserID,
+		Name:      p.Name,
+		CanEdit:   p.CanEdit,
+		authorize: p.Authorize,
+		send:      make(chan Message, clientBufferSize),
+		hub:       h,
+	}
+	h.clients.Add(1)
+
+	for {
+		r := h.room(analysisID)
+		select {
+		case r.join <- client:
+			client.room = r
+			return client
+		case <-r.done:
+			// The room emptied and shut down between lookup and join; start a new one.
+		}
+	}
+}
+
+// Close disconnects every client and waits until all of them have left, or
+// until ctx is done. Clients leave once whatever drives them, such as the
+// WebSocket pumps, sees its messages end, so nothing is left running against
+// resources the caller is about to release.
+func (h *Hub) Close(ctx context.Context) error {
+	h.mu.Lock()
+	rooms := make([]*room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		rooms = append(rooms, r)
+	}
+	h.mu.Unlock()
+
+	for _, r := range rooms {
+		select {
+		case r.disconnect <- struct{}{}:
+		case <-r.done:
+		}
+	}
+
+	left := make(chan struct{})
+	go func() {
+		h.clients.Wait()
+		close(left)
+	}()
+
+	select {
+	case <-left:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Presence returns who is currently connected to an analysis.
+func (h *Hub) Presence(analysisID int) []Presence {
+	h.mu.Lock()
+	r, ok := h.rooms[analysisID]
+	h.mu.Unlock()
+	if !ok {
+		return []Presence{}
+	}
+
+	reply := make(chan []Presence, 1)
+	select {
+	case r.presence <- reply:
+		return <-reply
+	case <-r.done:
+		return []Presence{}
+	}
+}
+
+func (h *Hub) room(analysisID int) *room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rooms[analysisID]
+	if !ok {
+		r = newRoom(analysisID)
+		h.rooms[analysisID] = r
+		go r.run(h)
+	}
+
+	return r
+}
+
+// removeRoom is called by a room goroutine once it has been empty for the
+// idle timeout.
+func (h *Hub) removeRoom(r *room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rooms[r.analysisID] == r {
+		delete(h.rooms, r.analysisID)
+	}
+}
@@ -0,0 +1,264 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const testTimeout = 2 * time.Second
+
+// next returns the next message of the given type, skipping presence updates
+// unless they are what is asked for.
+func next(t *testing.T, c *Client, want MessageType) Message {
+	t.Helper()
+
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case msg, ok := <-c.Messages():
+			if !ok {
+				t.Fatalf("client %d was disconnected waiting for %s", c.ID, want)
+			}
+			if msg.Type == want {
+				return msg
+			}
+			if msg.Type != MessagePresence {
+				t.Fatalf("client %d got %s (%+v) waiting for %s", c.ID, msg.Type, msg, want)
+			}
+		case <-timeout:
+			t.Fatalf("client %d timed out waiting for %s", c.ID, want)
+		}
+	}
+}
+
+// expectClosed waits for the client's messages to end, skipping what is left.
+func expectClosed(t *testing.T, c *Client) {
+	t.Helper()
+
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case _, ok := <-c.Messages():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("client %d was not disconnected", c.ID)
+		}
+	}
+}
+
+func join(t *testing.T, h *Hub, p Participant) *Client {
+	t.Helper()
+
+	c := h.Join(1, p)
+	t.Cleanup(c.Leave)
+	next(t, c, MessageSync)
+	return c
+}
+
+func editor(userID int) Participant {
+	return Participant{UserID: userID, Name: fmt.Sprintf("user %d", userID), CanEdit: true}
+}
+
+func parseWord(baseSeq int64, target string) Operation {
+	return Operation{BaseSeq: baseSeq, Type: OpParseWord, Target: target}
+}
+
+func TestSubmitAcksAndBroadcasts(t *testing.T) {
+	h := NewHub()
+	alice := join(t, h, editor(1))
+	bob := join(t, h, editor(2))
+
+	alice.Submit(parseWord(0, "word:1:1"))
+
+	ack := next(t, alice, MessageAck)
+	if ack.Seq != 1 || ack.Op.UserID != 1 || ack.Op.ClientID != alice.ID {
+		t.Errorf("ack = %+v, want seq 1 from alice", ack)
+	}
+
+	op := next(t, bob, MessageOp)
+	if op.Seq != 1 || op.Op.Target != "word:1:1" {
+		t.Errorf("broadcast = %+v, want word:1:1 at seq 1", op)
+	}
+}
+
+func TestSubmitRejectsConflicts(t *testing.T) {
+	h := NewHub()
+	alice := join(t, h, editor(1))
+	bob := join(t, h, editor(2))
+
+	alice.Submit(parseWord(0, "word:1:1"))
+	next(t, alice, MessageAck)
+	next(t, bob, MessageOp)
+
+	// Bob has not applied alice's operation to the same word.
+	bob.Submit(parseWord(0, "word:1:1"))
+
+	reject := next(t, bob, MessageReject)
+	if reject.Reason != RejectConflict {
+		t.Errorf("reason = %q, want %q", reject.Reason, RejectConflict)
+	}
+	if len(reject.Ops) != 1 || reject.Ops[0].Seq != 1 {
+		t.Errorf("ops = %+v, want alice's operation", reject.Ops)
+	}
+
+	// An operation on another word is not a conflict.
+	bob.Submit(parseWord(0, "word:1:2"))
+	if ack := next(t, bob, MessageAck); ack.Seq != 2 {
+		t.Errorf("ack seq = %d, want 2", ack.Seq)
+	}
+}
+
+func TestSubmitRejectsStaleOperations(t *testing.T) {
+	h := NewHub()
+	alice := join(t, h, editor(1))
+
+	for i := 0; i <= maxLogSize; i++ {
+		alice.Submit(parseWord(int64(i), fmt.Sprintf("word:1:%d", i)))
+		next(t, alice, MessageAck)
+	}
+
+	// The first operation has fallen off the log, so nothing can be ordered
+	// against a base sequence of 0 any more.
+	bob := join(t, h, editor(2))
+	bob.Submit(parseWord(0, "word:2:1"))
+
+	reject := next(t, bob, MessageReject)
+	if reject.Reason != RejectStale {
+		t.Errorf("reason = %q, want %q", reject.Reason, RejectStale)
+	}
+	if reject.Seq != maxLogSize+1 {
+		t.Errorf("seq = %d, want %d", reject.Seq, maxLogSize+1)
+	}
+}
+
+func TestViewersCannotSubmit(t *testing.T) {
+	h := NewHub()
+	viewer := join(t, h, Participant{UserID: 1, Name: "viewer"})
+
+	viewer.Submit(parseWord(0, "word:1:1"))
+
+	next(t, viewer, MessageError)
+}
+
+func TestLeaveCleansUp(t *testing.T) {
+	h := NewHub()
+	h.idleTimeout = 10 * time.Millisecond
+	alice := join(t, h, editor(1))
+	bob := join(t, h, editor(2))
+
+	bob.Leave()
+	expectClosed(t, bob)
+
+	presence := next(t, alice, MessagePresence)
+	for len(presence.Presence) != 1 {
+		presence = next(t, alice, MessagePresence)
+	}
+	if presence.Presence[0].ClientID != alice.ID {
+		t.Errorf("presence = %+v, want only alice", presence.Presence)
+	}
+
+	alice.Leave()
+	expectClosed(t, alice)
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		h.mu.Lock()
+		rooms := len(h.rooms)
+		h.mu.Unlock()
+		if rooms == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the empty room was not removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if presence := h.Presence(1); len(presence) != 0 {
+		t.Errorf("presence = %+v, want nobody", presence)
+	}
+}
+
+func TestReconnectResumesLog(t *testing.T) {
+	h := NewHub()
+	alice := h.Join(1, editor(1))
+	next(t, alice, MessageSync)
+
+	alice.Submit(parseWord(0, "word:1:1"))
+	next(t, alice, MessageAck)
+	alice.Leave()
+	expectClosed(t, alice)
+
+	// The room outlives its last client for the idle timeout.
+	again := join(t, h, editor(1))
+	again.Submit(parseWord(1, "word:1:2"))
+	if ack := next(t, again, MessageAck); ack.Seq != 2 {
+		t.Errorf("ack seq = %d, want 2", ack.Seq)
+	}
+}
+
+func TestSubmitRechecksAccess(t *testing.T) {
+	h := NewHub()
+
+	canEdit, access := true, error(nil)
+	p := editor(1)
+	p.Authorize = func() (bool, error) { return canEdit, access }
+	member := join(t, h, p)
+
+	member.Submit(parseWord(0, "word:1:1"))
+	next(t, member, MessageAck)
+
+	// Demoted to viewer while connected.
+	canEdit = false
+	member.Submit(parseWord(1, "word:1:2"))
+	next(t, member, MessageError)
+
+	// A failed check rejects the operation but keeps the connection.
+	access = errors.New("database is down")
+	member.Submit(parseWord(1, "word:1:2"))
+	next(t, member, MessageError)
+
+	// Removed from the analysis.
+	access = ErrNoAccess
+	member.Submit(parseWord(1, "word:1:2"))
+	next(t, member, MessageError)
+	expectClosed(t, member)
+}
+
+func TestCloseWaitsForClientsToLeave(t *testing.T) {
+	h := NewHub()
+
+	// Like the WebSocket pumps, each client leaves once its messages end.
+	for i := 1; i <= 2; i++ {
+		c := h.Join(i, editor(i))
+		go func() {
+			for range c.Messages() {
+			}
+			c.Leave()
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := h.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestCloseGivesUpAtDeadline(t *testing.T) {
+	h := NewHub()
+	c := h.Join(1, editor(1))
+	defer c.Leave()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want %v", err, context.DeadlineExceeded)
+	}
+	expectClosed(t, c)
+}
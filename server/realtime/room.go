@@ -0,0 +1,262 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// maxLogSize bounds the operation log kept per room. Clients whose base sequence
+// falls off the end of the log have to reload the analysis and resync.
+const maxLogSize = 500
+
+type OperationType string
+
+const (
+	OpParseWord       OperationType = "parseWord"
+	OpMoveLabel       OperationType = "moveLabel"
+	OpEditTranslation OperationType = "editTranslation"
+	OpAddPhrase       OperationType = "addPhrase"
+)
+
+func (t OperationType) valid() bool {
+	switch t {
+	case OpParseWord, OpMoveLabel, OpEditTranslation, OpAddPhrase:
+		return true
+	}
+	return false
+}
+
+// Operation is a single edit to an analysis.
+//
+// Target identifies what the operation changes (for example "word:3:12" or
+// "translation:3:0"); two operations conflict when they touch the same target
+// and neither had seen the other. BaseSeq is the last sequence number the
+// client had applied when it produced the operation.
+type Operation struct {
+	Seq        int64           `json:"seq"`
+	BaseSeq    int64           `json:"baseSeq"`
+	ClientOpID string          `json:"clientOpId,omitempty"`
+	Type       OperationType   `json:"type"`
+	Target     string          `json:"target"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	UserID     int             `json:"userId"`
+	ClientID   int64           `json:"clientId"`
+}
+
+type room struct {
+	analysisID int
+	clients    map[*Client]bool
+	log        []Operation
+	seq        int64
+
+	join       chan *Client
+	leave      chan *Client
+	submit     chan submission
+	presence   chan chan []Presence
+	disconnect chan struct{}
+	done       chan struct{}
+}
+
+// submission is an operation on its way to the room. When checked is set,
+// canEdit and err are the result of asking the participant's Authorize.
+type submission struct {
+	client  *Client
+	op      Operation
+	checked bool
+	canEdit bool
+	err     error
+}
+
+func newRoom(analysisID int) *room {
+	return &room{
+		analysisID: analysisID,
+		clients:    make(map[*Client]bool),
+		join:       make(chan *Client),
+		leave:      make(chan *Client),
+		submit:     make(chan submission),
+		presence:   make(chan chan []Presence),
+		disconnect: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (r *room) run(h *Hub) {
+	// idle fires once the room has been empty for the hub's idle timeout.
+	var idleTimer *time.Timer
+	var idle <-chan time.Time
+
+	for {
+		select {
+		case c := <-r.join:
+			r.clients[c] = true
+			r.send(c, Message{Type: MessageSync, Seq: r.seq, Ops: r.log})
+			r.broadcastPresence()
+
+		case c := <-r.leave:
+			r.remove(c)
+
+		case s := <-r.submit:
+			if r.clients[s.client] {
+				r.handle(s)
+			}
+
+		case reply := <-r.presence:
+			reply <- r.currentPresence()
+
+		case <-r.disconnect:
+			for c := range r.clients {
+				r.remove(c)
+			}
+
+		case <-idle:
+			h.removeRoom(r)
+			close(r.done)
+			return
+		}
+
+		switch {
+		case len(r.clients) > 0 && idle != nil:
+			idleTimer.Stop()
+			idleTimer, idle = nil, nil
+		case len(r.clients) == 0 && idle == nil:
+			idleTimer = time.NewTimer(h.idleTimeout)
+			idle = idleTimer.C
+		}
+	}
+}
+
+// handle applies a submission after settling what its sender may do now.
+// Clients that lost access are disconnected, and a changed role is reflected
+// in presence.
+func (r *room) handle(s submission) {
+	c := s.client
+
+	if s.checked {
+		if errors.Is(s.err, ErrNoAccess) {
+			r.send(c, Message{Type: MessageError, Error: "you no longer have access to this analysis"})
+			r.remove(c)
+			return
+		}
+		if s.err != nil {
+			slog.Error("Failed to check access to analysis", "analysisId", r.analysisID, "userId", c.UserID, "error", s.err)
+			r.send(c, Message{Type: MessageError, Error: "could not check your access to this analysis"})
+			return
+		}
+		if s.canEdit != c.CanEdit {
+			c.CanEdit = s.canEdit
+			r.broadcastPresence()
+		}
+	}
+
+	r.apply(c, s.op)
+}
+
+// apply orders an operation against the log. Accepted operations are
+// acknowledged to the sender and broadcast to everyone else; conflicting ones
+// are rejected together with the operations the sender has not seen yet.
+func (r *room) apply(c *Client, op Operation) {
+	if !c.CanEdit {
+		r.send(c, Message{Type: MessageError, Error: "you do not have permission to edit this analysis"})
+		return
+	}
+
+	if !op.Type.valid() || op.Target == "" {
+		r.send(c, Message{Type: MessageError, Error: "invalid operation"})
+		return
+	}
+
+	if op.BaseSeq > r.seq || op.BaseSeq < 0 {
+		r.send(c, Message{Type: MessageError, Error: "invalid base sequence"})
+		return
+	}
+
+	unseen := r.since(op.BaseSeq)
+	if unseen == nil {
+		r.send(c, Message{Type: MessageReject, Reason: RejectStale, Op: &op, Seq: r.seq})
+		return
+	}
+
+	for _, prev := range unseen {
+		if prev.Target == op.Target && prev.ClientID != c.ID {
+			r.send(c, Message{Type: MessageReject, Reason: RejectConflict, Op: &op, Seq: r.seq, Ops: unseen})
+			return
+		}
+	}
+
+	r.seq++
+	op.Seq = r.seq
+	op.UserID = c.UserID
+	op.ClientID = c.ID
+
+	r.log = append(r.log, op)
+	if len(r.log) > maxLogSize {
+		r.log = append([]Operation(nil), r.log[len(r.log)-maxLogSize:]...)
+	}
+
+	for client := range r.clients {
+		if client == c {
+			r.send(client, Message{Type: MessageAck, Op: &op, Seq: op.Seq})
+			continue
+		}
+		r.send(client, Message{Type: MessageOp, Op: &op, Seq: op.Seq})
+	}
+}
+
+// since returns the logged operations after baseSeq, or nil if some of them
+// have already been trimmed from the log.
+func (r *room) since(baseSeq int64) []Operation {
+	if baseSeq == r.seq {
+		return []Operation{}
+	}
+
+	if len(r.log) == 0 || r.log[0].Seq > baseSeq+1 {
+		return nil
+	}
+
+	start := int(baseSeq + 1 - r.log[0].Seq)
+	return r.log[start:]
+}
+
+// send delivers a message without blocking the room. A client that cannot
+// keep up is disconnected rather than stalling everyone else.
+func (r *room) send(c *Client, msg Message) {
+	select {
+	case c.send <- msg:
+	default:
+		r.remove(c)
+	}
+}
+
+func (r *room) remove(c *Client) {
+	if !r.clients[c] {
+		return
+	}
+
+	delete(r.clients, c)
+	close(c.send)
+	r.broadcastPresence()
+}
+
+func (r *room) broadcastPresence() {
+	presence := r.currentPresence()
+	for client := range r.clients {
+		r.send(client, Message{Type: MessagePresence, Presence: presence})
+	}
+}
+
+func (r *room) currentPresence() []Presence {
+	presence := make([]Presence, 0, len(r.clients))
+	for client := range r.clients {
+		presence = append(presence, Presence{
+			ClientID: client.ID,
+			UserID:   client.UserID,
+			Name:     client.Name,
+			CanEdit:  client.CanEdit,
+		})
+	}
+
+	sortPresence(presence)
+	return presence
+}
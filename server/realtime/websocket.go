@@ -0,0 +1,83 @@
+package realtime
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 64 * 1024
+)
+
+// ServeWebSocket pumps messages between a WebSocket connection and a client
+// until either side goes away. It blocks until the connection is closed and
+// always leaves the room before returning.
+func ServeWebSocket(conn *websocket.Conn, client *Client) {
+	defer client.Leave()
+
+	go writePump(conn, client)
+	readPump(conn, client)
+}
+
+func readPump(conn *websocket.Conn, client *Client) {
+	defer conn.Close()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var msg struct {
+			Type MessageType `json:"type"`
+			Op   *Operation  `json:"op"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("Unexpected websocket close", "clientId", client.ID, "error", err)
+			}
+			return
+		}
+
+		if msg.Type != MessageSubmit || msg.Op == nil {
+			continue
+		}
+
+		client.Submit(*msg.Op)
+	}
+}
+
+func writePump(conn *websocket.Conn, client *Client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-client.Messages():
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize bounds uploads to the import endpoint.
+const maxImportSize = 50 << 20
+
+// exportAccountHandler streams a zip archive of the user's account data.
+func exportAccountHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	export, err := service.LoadAccountExport(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	filename := fmt.Sprintf("greek-study-tool-export-%s.zip", time.Now().UTC().Format("2006-01-02"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent once the archive starts streaming, so a failure
+	// here can only be logged; the client sees a truncated archive.
+	if err := export.Write(c.Request.Context(), c.Writer); err != nil {
+		slog.Error("Failed to export account", "userID", userID, "error", err)
+	}
+}
+
+// importAccountHandler accepts an account export archive or a single analysis
+// JSON, either as a multipart "file" field or as the raw request body.
+func importAccountHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	var body io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, "Failed to read uploaded file"))
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusRequestEntityTooLarge, "Import is too large"))
+		return
+	}
+
+	report, err := service.ImportAccount(c.Request.Context(), userID, data)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// deleteAccountHandler deletes the user's account. With ?graceDays=N the purge
+// is scheduled N days out and can be cancelled until then.
+func deleteAccountHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	graceDays, err := strconv.Atoi(c.DefaultQuery("graceDays", "0"))
+	if err != nil || graceDays < 0 {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "graceDays must be a non-negative number"))
+		return
+	}
+
+	deletion, err := service.DeleteAccount(c.Request.Context(), userID, time.Duration(graceDays)*24*time.Hour, "self")
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	if deletion.Purged {
+		c.JSON(http.StatusOK, deletion)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, deletion)
+}
+
+func cancelAccountDeletionHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	if err := service.CancelAccountDeletion(c.Request.Context(), userID); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
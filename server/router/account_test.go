@@ -0,0 +1,60 @@
+package router
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestImportRejectsCorruptArchives(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"version": 1}`))
+	zw.Close()
+	// Change the stored manifest so it no longer matches its checksum.
+	badChecksum := bytes.Replace(archive.Bytes(), []byte(`"version"`), []byte(`"VERSION"`), 1)
+
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"not a zip", "PK\x03\x04 but nothing else", "archive is not a valid zip"},
+		{"unreadable manifest", string(badChecksum), "manifest.json could not be read"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter(t)
+			r.POST("/api/me/import", importAccountHandler)
+
+			w := serve(r, http.MethodPost, "/api/me/import", test.body)
+
+			envelope := expectError(t, w, http.StatusBadRequest, "invalid_argument")
+			if !strings.HasPrefix(envelope.Error.Message, test.message) {
+				t.Errorf("message = %q, want it to start with %q", envelope.Error.Message, test.message)
+			}
+		})
+	}
+}
+
+func TestExportReportsLoadFailures(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.GET("/api/me/export", exportAccountHandler)
+
+	mock.ExpectQuery("FROM users").WillReturnError(io.ErrUnexpectedEOF)
+
+	w := serve(r, http.MethodGet, "/api/me/export", "")
+
+	expectError(t, w, http.StatusInternalServerError, "internal")
+	if got := w.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("Content-Disposition = %q, want no attachment", got)
+	}
+}
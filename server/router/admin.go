@@ -0,0 +1,117 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+type setUserRoleRequest struct {
+	Role service.UserRole `json:"role" binding:"required"`
+}
+
+type reassignAnalysisRequest struct {
+	UserID int `json:"userId" binding:"required"`
+}
+
+func adminListUsersHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid limit"))
+		return
+	}
+
+	page, err := service.ListUsers(c.Request.Context(), c.Query("q"), c.Query("page"), limit)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func adminGetUserUsageHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid user ID"))
+		return
+	}
+
+	usage, err := service.GetUserUsage(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+func adminSetUserRoleHandler(c *gin.Context) {
+	adminID := currentUserID(c)
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid user ID"))
+		return
+	}
+
+	var req setUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	if err := service.SetUserRole(c.Request.Context(), userID, req.Role, adminID); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// adminSetUserDisabledHandler disables or, with disabled false, re-enables an
+// account.
+func adminSetUserDisabledHandler(disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID := currentUserID(c)
+
+		userID, err := strconv.Atoi(c.Param("userId"))
+		if err != nil {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid user ID"))
+			return
+		}
+
+		if err := service.SetUserDisabled(c.Request.Context(), userID, disabled, adminID); err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+func adminReassignAnalysisHandler(c *gin.Context) {
+	adminID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	var req reassignAnalysisRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	if err := service.ReassignAnalysis(c.Request.Context(), analysisID, req.UserID, adminID); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -4,179 +4,257 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/middleware"
 	"github.com/ZacharyWM/greek-study-tool/server/service"
 	"github.com/gin-gonic/gin"
 )
 
-// getUserIDFromIdpID retrieves the user's internal ID from the IdP ID (sub claim)
-func getUserIDFromIdpID(c *gin.Context, idpID string) (int, error) {
-	user, err := service.GetUserByIdpID(c.Request.Context(), idpID)
-	if err != nil {
-		return 0, err
-	}
-	return user.ID, nil
+// currentUserID returns the internal ID of the user the auth middleware
+// signed in.
+func currentUserID(c *gin.Context) int {
+	return middleware.UserFromContext(c).ID
 }
 
 // createAnalysisHandler handles the creation of a new analysis
 func createAnalysisHandler(c *gin.Context) {
-	claims := auth.ClaimsFromContext(c)
-	if claims == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	idpID := claims.RegisteredClaims.Subject
-	userID, err := getUserIDFromIdpID(c, idpID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID"})
-		return
-	}
+	userID := currentUserID(c)
 
 	var analysis service.Analysis
 	if err := c.ShouldBindJSON(&analysis); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
 		return
 	}
 
 	analysis.UserID = userID
 
-	id, err := service.InsertAnalysis(analysis)
+	id, err := service.InsertAnalysis(c.Request.Context(), analysis)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Abort(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"id": id})
 }
 
-func updateAnalysisHandler(c *gin.Context) {
-	claims := auth.ClaimsFromContext(c)
-	if claims == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+// createAnalysisFromPassageHandler creates an analysis of a passage, built from the corpus
+func createAnalysisFromPassageHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var options service.PassageOptions
+	if err := c.ShouldBindJSON(&options); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
 		return
 	}
 
-	idpID := claims.RegisteredClaims.Subject
-	userID, err := getUserIDFromIdpID(c, idpID)
+	analysis, err := service.CreateAnalysisFromPassage(c.Request.Context(), userID, options)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID"})
+		apierror.Abort(c, err)
 		return
 	}
 
+	c.JSON(http.StatusCreated, analysis)
+}
+
+func updateAnalysisHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
 	analysisID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid analysis ID"})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
 		return
 	}
 
 	var analysisUpdate service.Analysis
 	if err := c.ShouldBindJSON(&analysisUpdate); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
 		return
 	}
 
 	analysisUpdate.UserID = userID
 	analysisUpdate.ID = analysisID
 
-	err = service.UpdateAnalysis(analysisUpdate)
+	err = service.UpdateAnalysis(c.Request.Context(), analysisUpdate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Abort(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-func getAnalysisHandler(c *gin.Context) {
-	claims := auth.ClaimsFromContext(c)
-	if claims == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
+// getAnalysisHandler returns an analysis by ID and makes it the one the user
+// last had open. With legacyLatest set, ID 0 still means the most recently
+// updated analysis, for clients that predate /analyses/latest.
+func getAnalysisHandler(legacyLatest bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		analysisID, err := strconv.Atoi(c.Param("id"))
+		if err != nil || (analysisID == 0 && !legacyLatest) {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+			return
+		}
 
-	idpID := claims.RegisteredClaims.Subject
-	userID, err := getUserIDFromIdpID(c, idpID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID"})
-		return
-	}
+		if analysisID == 0 {
+			getLatestAnalysisHandler(c)
+			return
+		}
 
-	analysisID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid analysis ID"})
-		return
-	}
+		userID := currentUserID(c)
 
-	// TODO - Could have query param to determine if we want latest or new.
-	if analysisID == 0 {
-		analysis, err := service.GetLastUpdatedAnalysis(userID)
+		analysis, err := service.GetAnalysisById(c.Request.Context(), analysisID, userID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			apierror.Abort(c, err)
 			return
 		}
 
+		// The analysis is still worth returning if this fails; the service
+		// has logged it.
+		service.RecordOpenedAnalysis(c.Request.Context(), userID, analysisID)
+
 		c.JSON(http.StatusOK, analysis)
-		return
 	}
+}
+
+// getLatestAnalysisHandler returns the user's most recently updated analysis.
+func getLatestAnalysisHandler(c *gin.Context) {
+	userID := currentUserID(c)
 
-	analysis, err := service.GetAnalysisById(analysisID, userID)
+	analysis, err := service.GetLastUpdatedAnalysis(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		apierror.Abort(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, analysis)
 }
 
+// analysisQueryParams are the parameters that make getUserAnalysesHandler
+// search and return a page.
+var analysisQueryParams = []string{"q", "tag", "folder", "book", "sort", "page", "limit"}
+
+// getUserAnalysesHandler lists the analyses the user can open. With any of
+// analysisQueryParams it returns one page of matches as {items, nextPage};
+// without them it returns every analysis as a bare array, as it did before
+// search was added, so existing clients keep working.
 func getUserAnalysesHandler(c *gin.Context) {
-	claims := auth.ClaimsFromContext(c)
-	if claims == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: missing claims"})
+	userID := currentUserID(c)
+
+	if !hasAnyQuery(c, analysisQueryParams) {
+		analyses, err := service.GetAnalysesForUser(c.Request.Context(), userID)
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, analyses)
 		return
 	}
 
-	idpID := claims.RegisteredClaims.Subject
-	userID, err := getUserIDFromIdpID(c, idpID)
+	folderID, err := parseOptionalID(c.Query("folder"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID"})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid folder ID"))
 		return
 	}
 
-	analyses, err := service.GetAnalysesForUser(userID)
+	bookID, err := parseOptionalID(c.Query("book"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid book ID"))
 		return
 	}
 
-	c.JSON(http.StatusOK, analyses)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid limit"))
+		return
+	}
+
+	query := service.AnalysisQuery{
+		Q:        c.Query("q"),
+		Tag:      c.Query("tag"),
+		FolderID: folderID,
+		BookID:   bookID,
+		Sort:     c.Query("sort"),
+		Page:     c.Query("page"),
+		Limit:    limit,
+	}
+
+	page, err := service.SearchAnalyses(c.Request.Context(), userID, query)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
 }
 
 func deleteAnalysisHandler(c *gin.Context) {
-	claims := auth.ClaimsFromContext(c)
-	if claims == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
 		return
 	}
 
-	idpID := claims.RegisteredClaims.Subject
-	userID, err := getUserIDFromIdpID(c, idpID)
+	err = service.DeleteAnalysis(c.Request.Context(), analysisID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID"})
+		apierror.Abort(c, err)
 		return
 	}
 
-	analysisID, err := strconv.Atoi(c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func getTrashHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analyses, err := service.GetTrash(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid analysis ID"})
+		apierror.Abort(c, err)
 		return
 	}
 
-	err = service.DeleteAnalysis(analysisID, userID)
+	c.JSON(http.StatusOK, analyses)
+}
+
+func restoreAnalysisHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	if err := service.RestoreAnalysis(c.Request.Context(), analysisID, userID); err != nil {
+		apierror.Abort(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
+
+// parseOptionalID parses an optional numeric ID; an empty value yields nil.
+func parseOptionalID(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+// hasAnyQuery reports whether the request has any of the query parameters.
+func hasAnyQuery(c *gin.Context, params []string) bool {
+	query := c.Request.URL.Query()
+	for _, param := range params {
+		if query.Has(param) {
+			return true
+		}
+	}
+	return false
+}
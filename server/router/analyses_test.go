@@ -0,0 +1,305 @@
+package router
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const analysisUpdate = `{"title": "John 1", "details": {"sections": []}}`
+
+// expectRole answers the role lookup that explains why a change matched no
+// rows. An empty role means the user has no access.
+func expectRole(mock sqlmock.Sqlmock, role string) {
+	rows := sqlmock.NewRows([]string{"role"})
+	if role != "" {
+		rows.AddRow(role)
+	}
+	mock.ExpectQuery("SELECT CASE WHEN a.user_id").WillReturnRows(rows)
+}
+
+// expectAnalysis answers GetAnalysisById with an analysis testUser owns and
+// that has no passages.
+func expectAnalysis(mock sqlmock.Sqlmock, id int) {
+	mock.ExpectQuery("SELECT a.id, a.user_id, a.details").
+		WithArgs(id, testUser.ID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "user_id", "details", "created_at", "updated_at", "title", "description", "role", "parent_id", "template_id",
+		}).AddRow(id, testUser.ID, `{"lineSpacing": 2}`, "2026-01-01", "2026-01-02", "John 1", "", "owner", nil, nil))
+	mock.ExpectQuery("FROM analysis_passages").
+		WillReturnRows(sqlmock.NewRows([]string{"analysis_id", "start", "end", "sb", "sc", "sv", "eb", "ec", "ev"}))
+}
+
+func TestUpdateAnalysisErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		role   string
+		status int
+		code   string
+	}{
+		{"missing analysis", "", http.StatusNotFound, "not_found"},
+		{"viewer", "viewer", http.StatusForbidden, "permission_denied"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, mock := newTestRouter(t)
+			r.PATCH("/api/analyses/:id", updateAnalysisHandler)
+
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE analyses").WillReturnResult(sqlmock.NewResult(0, 0))
+			expectRole(mock, test.role)
+			mock.ExpectRollback()
+
+			w := serve(r, http.MethodPatch, "/api/analyses/7", analysisUpdate)
+
+			expectError(t, w, test.status, test.code)
+		})
+	}
+}
+
+func TestUpdateAnalysisKeepsStoredPassages(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.PATCH("/api/analyses/:id", updateAnalysisHandler)
+
+	// No passages in the body, so nothing is derived and analysis_passages is
+	// left alone.
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE analyses").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := serve(r, http.MethodPatch, "/api/analyses/7", analysisUpdate)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
+
+func TestUpdateAnalysisRejectsBadBody(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.PATCH("/api/analyses/:id", updateAnalysisHandler)
+
+	w := serve(r, http.MethodPatch, "/api/analyses/7", `{"title": `)
+
+	expectError(t, w, http.StatusBadRequest, "invalid_argument")
+}
+
+func TestDeleteAnalysisErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		role   string
+		status int
+		code   string
+	}{
+		{"missing analysis", "", http.StatusNotFound, "not_found"},
+		{"editor", "editor", http.StatusForbidden, "permission_denied"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, mock := newTestRouter(t)
+			r.DELETE("/api/analyses/:id", deleteAnalysisHandler)
+
+			mock.ExpectExec("UPDATE analyses SET deleted_at").WillReturnResult(sqlmock.NewResult(0, 0))
+			expectRole(mock, test.role)
+
+			w := serve(r, http.MethodDelete, "/api/analyses/7", "")
+
+			expectError(t, w, test.status, test.code)
+		})
+	}
+}
+
+func TestRestoreAnalysisAsEditor(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.POST("/api/analyses/:id/restore", restoreAnalysisHandler)
+
+	mock.ExpectExec("UPDATE analyses SET deleted_at = NULL").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT CASE WHEN a.user_id").
+		WithArgs(7, testUser.ID, true).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("editor"))
+
+	w := serve(r, http.MethodPost, "/api/analyses/7/restore", "")
+
+	expectError(t, w, http.StatusForbidden, "permission_denied")
+}
+
+func TestSearchAnalysesRejectsBadCursors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"not base64", "page=%25%25%25"},
+		{"not a cursor", "page=" + base64.RawURLEncoding.EncodeToString([]byte("not json"))},
+		{"unparsable key", "page=" + base64.RawURLEncoding.EncodeToString([]byte(`{"s":"updated","k":"yesterday","i":3}`))},
+		{"other sort", "sort=updated&page=" + base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","k":"romans","i":3}`))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter(t)
+			r.GET("/api/analyses", getUserAnalysesHandler)
+
+			w := serve(r, http.MethodGet, "/api/analyses?"+test.query, "")
+
+			envelope := expectError(t, w, http.StatusBadRequest, "invalid_argument")
+			if envelope.Error.Message != "invalid page cursor" {
+				t.Errorf("message = %q, want %q", envelope.Error.Message, "invalid page cursor")
+			}
+		})
+	}
+}
+
+func TestGetAnalysisMissing(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.GET("/api/analyses/:id", getAnalysisHandler(false))
+
+	mock.ExpectQuery("SELECT a.id, a.user_id").WillReturnError(sql.ErrNoRows)
+
+	w := serve(r, http.MethodGet, "/api/analyses/7", "")
+
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
+
+func TestListAnalysesShape(t *testing.T) {
+	columns := []string{"id", "user_id", "created_at", "updated_at", "title", "description", "role"}
+
+	t.Run("without parameters", func(t *testing.T) {
+		r, mock := newTestRouter(t)
+		r.GET("/api/analyses", getUserAnalysesHandler)
+
+		mock.ExpectQuery("order by a.updated_at desc").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(7, 1, "2026-01-01", "2026-01-02", "John 1", "", "owner"))
+
+		w := serve(r, http.MethodGet, "/api/analyses", "")
+
+		var analyses []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &analyses); err != nil {
+			t.Fatalf("want a bare array: %v; body: %s", err, w.Body)
+		}
+		if len(analyses) != 1 {
+			t.Errorf("got %d analyses, want 1", len(analyses))
+		}
+	})
+
+	t.Run("with parameters", func(t *testing.T) {
+		r, mock := newTestRouter(t)
+		r.GET("/api/analyses", getUserAnalysesHandler)
+
+		mock.ExpectQuery("LEFT JOIN user_analysis_folders").
+			WillReturnRows(sqlmock.NewRows(append(columns, "folder_id", "tags", "key")))
+
+		w := serve(r, http.MethodGet, "/api/analyses?limit=10", "")
+
+		var page struct {
+			Items []interface{} `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || page.Items == nil {
+			t.Fatalf("want {items, nextPage}: %v; body: %s", err, w.Body)
+		}
+	})
+}
+
+func TestGetAnalysisRecordsItAsLastOpened(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.GET("/api/analyses/:id", getAnalysisHandler(false))
+
+	expectAnalysis(mock, 7)
+	mock.ExpectExec("INSERT INTO user_workspaces").
+		WithArgs(testUser.ID, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := serve(r, http.MethodGet, "/api/analyses/7", "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
+
+func TestGetAnalysisSurvivesWorkspaceFailures(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.GET("/api/analyses/:id", getAnalysisHandler(false))
+
+	expectAnalysis(mock, 7)
+	mock.ExpectExec("INSERT INTO user_workspaces").WillReturnError(sql.ErrConnDone)
+
+	w := serve(r, http.MethodGet, "/api/analyses/7", "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
+
+// passageDetails matches the details of an analysis built from a passage,
+// recording the words of each section.
+type passageDetails struct {
+	sections [][]string
+}
+
+func (d *passageDetails) Match(value driver.Value) bool {
+	data, ok := value.([]byte)
+	if !ok {
+		return false
+	}
+
+	var details struct {
+		Sections []struct {
+			Words []struct {
+				Text string `json:"text"`
+			} `json:"words"`
+		} `json:"sections"`
+	}
+	if err := json.Unmarshal(data, &details); err != nil {
+		return false
+	}
+
+	d.sections = nil
+	for _, section := range details.Sections {
+		var words []string
+		for _, word := range section.Words {
+			words = append(words, word.Text)
+		}
+		d.sections = append(d.sections, words)
+	}
+	return true
+}
+
+func TestCreateFromPassageBuildsOneSection(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.POST("/api/analyses/from-passage", createAnalysisFromPassageHandler)
+
+	columns := []string{"verse_id", "book", "chapter", "verse", "word_id", "text", "lemma", "strong", "morph", "definition"}
+	mock.ExpectQuery("FROM verses v").
+		WithArgs(10, 11).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(10, "John", 1, 1, 100, "Ἐν", "ἐν", "G1722", "PREP", "in").
+			AddRow(10, "John", 1, 1, 101, "ἀρχῇ", "ἀρχή", "G746", "N-DSF", "beginning").
+			AddRow(11, "John", 1, 2, 102, "οὗτος", "οὗτος", "G3778", "D-NSM", "this"))
+
+	details := &passageDetails{}
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO analyses").
+		WithArgs(testUser.ID, details, "John 1:1-2", sqlmock.AnyArg(), nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec("DELETE FROM analysis_passages").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO analysis_passages").WithArgs(7, 10, 11).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE analyses SET passages_backfilled").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectAnalysis(mock, 7)
+
+	w := serve(r, http.MethodPost, "/api/analyses/from-passage", `{"startVerseId": 10, "endVerseId": 11}`)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	want := [][]string{{"[1]", "Ἐν", "ἀρχῇ", "[2]", "οὗτος"}}
+	if !reflect.DeepEqual(details.sections, want) {
+		t.Errorf("sections = %q, want %q", details.sections, want)
+	}
+}
@@ -4,14 +4,15 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
 	"github.com/ZacharyWM/greek-study-tool/server/service"
 	"github.com/gin-gonic/gin"
 )
 
 func getBooksHandler(c *gin.Context) {
-	books, err := service.GetBooks()
+	books, err := service.GetBooks(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve books"})
+		apierror.Abort(c, err)
 		return
 	}
 
@@ -21,13 +22,13 @@ func getBooksHandler(c *gin.Context) {
 func getChaptersHandler(c *gin.Context) {
 	bookID, err := strconv.Atoi(c.Param("bookId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "bookId is required"})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "bookId is required"))
 		return
 	}
 
-	chapters, err := service.GetChapters(bookID)
+	chapters, err := service.GetChapters(c.Request.Context(), bookID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chapters"})
+		apierror.Abort(c, err)
 		return
 	}
 
@@ -37,13 +38,13 @@ func getChaptersHandler(c *gin.Context) {
 func getVersesHandler(c *gin.Context) {
 	chapterID, err := strconv.Atoi(c.Param("chapterId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "chapterId is required"})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "chapterId is required"))
 		return
 	}
 
-	verses, err := service.GetVerses(chapterID)
+	verses, err := service.GetVerses(c.Request.Context(), chapterID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve verses"})
+		apierror.Abort(c, err)
 		return
 	}
 
@@ -53,18 +54,18 @@ func getVersesHandler(c *gin.Context) {
 func getVersesHandlerWithWords(c *gin.Context) {
 	startId, err := strconv.Atoi(c.Query("startId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "startId is required"})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "startId is required"))
 		return
 	}
 	endId, err := strconv.Atoi(c.Query("endId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "endId is required"})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "endId is required"))
 		return
 	}
 
-	verses, err := service.GetVersesWithWords(startId, endId)
+	verses, err := service.GetVersesWithWords(c.Request.Context(), startId, endId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve verses"})
+		apierror.Abort(c, err)
 		return
 	}
 
@@ -74,13 +75,13 @@ func getVersesHandlerWithWords(c *gin.Context) {
 func getStrongsWordHandler(c *gin.Context) {
 	code := c.Param("code")
 	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "code is required"))
 		return
 	}
 
-	strongsWord, err := service.GetStrongsWord(code)
+	strongsWord, err := service.GetStrongsWord(c.Request.Context(), code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve strongs word"})
+		apierror.Abort(c, err)
 		return
 	}
 
@@ -90,15 +91,33 @@ func getStrongsWordHandler(c *gin.Context) {
 func getStrongsWordByTextHandler(c *gin.Context) {
 	text := c.Param("text")
 	if text == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "text is required"))
 		return
 	}
 
-	strongsWord, err := service.GetStrongsWordByText(text)
+	strongsWord, err := service.GetStrongsWordByText(c.Request.Context(), text)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve strongs word by text"})
+		apierror.Abort(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, strongsWord)
 }
+
+func getVerseAnalysesHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	verseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid verse ID"))
+		return
+	}
+
+	analyses, err := service.GetAnalysesForVerse(c.Request.Context(), verseID, userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, analyses)
+}
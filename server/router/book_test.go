@@ -0,0 +1,101 @@
+package router
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+)
+
+func TestGetStrongsWordUnknownCode(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.GET("/api/strongs/:code", getStrongsWordHandler)
+
+	mock.ExpectQuery("SELECT code, lemma, definitions FROM strongs").
+		WithArgs("G99999").
+		WillReturnError(sql.ErrNoRows)
+
+	w := serve(r, http.MethodGet, "/api/strongs/G99999", "")
+
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
+
+func TestGetStrongsWordByText(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.GET("/api/word/:text/strongs", getStrongsWordByTextHandler)
+
+	mock.ExpectQuery("FROM words w").
+		WithArgs("λόγος").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "lemma", "definitions"}).
+			AddRow("G3056", "λόγος", `[{"definition": "word"}]`))
+
+	w := serve(r, http.MethodGet, "/api/word/λόγος/strongs", "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var word service.StrongsWord
+	if err := json.Unmarshal(w.Body.Bytes(), &word); err != nil {
+		t.Fatal(err)
+	}
+	if word.Strong != "G3056" || word.Lemma != "λόγος" {
+		t.Errorf("word = %+v, want G3056 λόγος", word)
+	}
+}
+
+func TestGetStrongsWordByTextErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"unknown word", sql.ErrNoRows, http.StatusNotFound, "not_found"},
+		{"database error", sql.ErrConnDone, http.StatusInternalServerError, "internal"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, mock := newTestRouter(t)
+			r.GET("/api/word/:text/strongs", getStrongsWordByTextHandler)
+
+			mock.ExpectQuery("FROM words w").
+				WithArgs("λόγος").
+				WillReturnError(test.err)
+
+			w := serve(r, http.MethodGet, "/api/word/λόγος/strongs", "")
+
+			expectError(t, w, test.status, test.code)
+		})
+	}
+}
+
+func TestGetVersesWithWordsReversedRange(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.GET("/api/verses", getVersesHandlerWithWords)
+
+	w := serve(r, http.MethodGet, "/api/verses?startId=9&endId=3", "")
+
+	expectError(t, w, http.StatusBadRequest, "invalid_argument")
+}
+
+func TestGetVersesWithWordsEmptyRange(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.GET("/api/verses", getVersesHandlerWithWords)
+
+	mock.ExpectQuery("FROM verses v").
+		WithArgs(999990, 999999).
+		WillReturnRows(sqlmock.NewRows([]string{"verses"}).AddRow("[]"))
+
+	w := serve(r, http.MethodGet, "/api/verses?startId=999990&endId=999999", "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if body := w.Body.String(); body != "[]" {
+		t.Errorf("body = %s, want []", body)
+	}
+}
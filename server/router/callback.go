@@ -1,50 +1,88 @@
 package router
 
 import (
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
 	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
 // callbackHandler for our callback.
-func callbackHandler(auth *auth.Authenticator) gin.HandlerFunc {
+func callbackHandler(idp auth.IdentityProvider) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		session := sessions.Default(ctx)
-		if ctx.Query("state") != session.Get("state") {
-			ctx.String(http.StatusBadRequest, "Invalid state parameter.")
+		state, _ := session.Get(auth.SessionState).(string)
+		nonce, _ := session.Get(auth.SessionNonce).(string)
+		verifier, _ := session.Get(auth.SessionVerifier).(string)
+
+		// The login values are single use, whatever the outcome.
+		session.Delete(auth.SessionState)
+		session.Delete(auth.SessionNonce)
+		session.Delete(auth.SessionVerifier)
+
+		if state == "" || ctx.Query("state") != state {
+			session.Save()
+			apierror.Abort(ctx, apierror.New(http.StatusBadRequest, "Invalid state parameter."))
 			return
 		}
 
 		// Exchange an authorization code for a token.
-		token, err := auth.Exchange(ctx.Request.Context(), ctx.Query("code"))
+		token, err := idp.ExchangeCode(ctx.Request.Context(), ctx.Query("code"), verifier)
 		if err != nil {
-			ctx.String(http.StatusUnauthorized, "Failed to convert an authorization code into a token.")
+			session.Save()
+			slog.Error("Failed to exchange authorization code", "error", err)
+			apierror.Abort(ctx, apierror.New(http.StatusUnauthorized, "Failed to convert an authorization code into a token."))
 			return
 		}
 
-		idToken, err := auth.VerifyIDToken(ctx.Request.Context(), token)
+		idToken, err := idp.VerifyIDToken(ctx.Request.Context(), token, nonce)
 		if err != nil {
-			ctx.String(http.StatusInternalServerError, "Failed to verify ID Token.")
+			session.Save()
+			slog.Error("Failed to verify ID token", "error", err)
+			apierror.Abort(ctx, apierror.New(http.StatusUnauthorized, "Failed to verify ID Token."))
 			return
 		}
 
-		var profile map[string]interface{}
+		var profile auth.Profile
 		if err := idToken.Claims(&profile); err != nil {
-			ctx.String(http.StatusInternalServerError, err.Error())
+			apierror.Abort(ctx, apierror.FromError(http.StatusInternalServerError, err))
 			return
 		}
 
-		// Here we need to save user information from Auth0 into the session
-		session.Set("access_token", token.AccessToken)
-		session.Set("profile", profile)
+		refreshedAt := time.Now()
+		_, err = service.InsertUser(ctx.Request.Context(), service.User{
+			IdpID:              idToken.Subject,
+			FirstName:          profile.GivenName,
+			LastName:           profile.FamilyName,
+			Nickname:           profile.Nickname,
+			Name:               profile.Name,
+			Picture:            profile.Picture,
+			Email:              profile.Email,
+			EmailVerified:      profile.EmailVerified,
+			ProfileRefreshedAt: &refreshedAt,
+		})
+		if err != nil {
+			apierror.Abort(ctx, apierror.Wrap(err, http.StatusInternalServerError, "Failed to save user."))
+			return
+		}
+
+		session.Set(auth.SessionSubject, idToken.Subject)
+		session.Set(auth.SessionExpiresAt, time.Now().Add(auth.SessionLifetime).Unix())
+		// Kept as the id_token_hint for logging out of the provider.
+		if rawIDToken, ok := token.Extra("id_token").(string); ok {
+			session.Set(auth.SessionIDToken, rawIDToken)
+		}
 		if err := session.Save(); err != nil {
-			ctx.String(http.StatusInternalServerError, err.Error())
+			apierror.Abort(ctx, apierror.FromError(http.StatusInternalServerError, err))
 			return
 		}
 
 		// Redirect to logged in page.
-		ctx.Redirect(http.StatusTemporaryRedirect, "/user")
+		ctx.Redirect(http.StatusTemporaryRedirect, "/")
 	}
 }
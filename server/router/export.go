@@ -0,0 +1,81 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/export"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func exportAnalysisPDFHandler(c *gin.Context) {
+	writeAnalysisExport(c, "pdf")
+}
+
+// exportAnalysisHandler serves /analyses/:id/export?format=md|tex|html|pdf.
+func exportAnalysisHandler(c *gin.Context) {
+	writeAnalysisExport(c, c.DefaultQuery("format", "md"))
+}
+
+func writeAnalysisExport(c *gin.Context, formatName string) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	format, ok := export.LookupFormat(formatName)
+	if !ok {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest,
+			fmt.Sprintf("format must be one of: %s", strings.Join(export.FormatNames(), ", "))))
+		return
+	}
+
+	analysis, err := service.GetAnalysisById(c.Request.Context(), analysisID, userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	doc, err := export.NewDocument(analysis)
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusUnprocessableEntity, "Failed to read analysis details"))
+		return
+	}
+
+	preferences, err := service.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	doc.ApplyPreferences(preferences)
+
+	var buf bytes.Buffer
+	if err := format.Render(&buf, doc); err != nil {
+		apierror.Abort(c, apierror.Wrap(err, http.StatusInternalServerError, "Failed to render export"))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, exportFilename(analysis), format.Extension))
+	c.Data(http.StatusOK, format.ContentType, buf.Bytes())
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// exportFilename derives an ASCII-safe download name from the analysis title.
+func exportFilename(analysis service.Analysis) string {
+	name := strings.Trim(unsafeFilenameChars.ReplaceAllString(analysis.Title, "-"), "-")
+	if name == "" {
+		name = "analysis-" + strconv.Itoa(analysis.ID)
+	}
+
+	return name
+}
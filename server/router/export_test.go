@@ -0,0 +1,18 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExportRejectsUnknownFormat(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.GET("/api/analyses/:id/export", exportAnalysisHandler)
+
+	w := serve(r, http.MethodGet, "/api/analyses/7/export?format=docx", "")
+
+	envelope := expectError(t, w, http.StatusBadRequest, "invalid_argument")
+	if want := "format must be one of: html, md, pdf, tex"; envelope.Error.Message != want {
+		t.Errorf("message = %q, want %q", envelope.Error.Message, want)
+	}
+}
@@ -0,0 +1,151 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+type folderRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type analysisFolderRequest struct {
+	FolderID *int `json:"folderId"`
+}
+
+type analysisTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+func getFoldersHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	folders, err := service.GetFolders(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, folders)
+}
+
+func createFolderHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var req folderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	folder, err := service.InsertFolder(c.Request.Context(), userID, req.Name)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, folder)
+}
+
+func renameFolderHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	folderID, err := strconv.Atoi(c.Param("folderId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid folder ID"))
+		return
+	}
+
+	var req folderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	if err := service.RenameFolder(c.Request.Context(), folderID, userID, req.Name); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func deleteFolderHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	folderID, err := strconv.Atoi(c.Param("folderId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid folder ID"))
+		return
+	}
+
+	if err := service.DeleteFolder(c.Request.Context(), folderID, userID); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func setAnalysisFolderHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	var req analysisFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	if err := service.SetAnalysisFolder(c.Request.Context(), analysisID, userID, req.FolderID); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func setAnalysisTagsHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	var req analysisTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	tags, err := service.SetAnalysisTags(c.Request.Context(), analysisID, userID, req.Tags)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+func getTagsHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	tags, err := service.GetTags(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
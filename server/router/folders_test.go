@@ -0,0 +1,54 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestCreateFolderRejectsDuplicateNames(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.POST("/api/folders", createFolderHandler)
+
+	mock.ExpectQuery("INSERT INTO folders").WillReturnError(&pq.Error{Code: "23505"})
+
+	w := serve(r, http.MethodPost, "/api/folders", `{"name": "Romans"}`)
+
+	expectError(t, w, http.StatusConflict, "conflict")
+}
+
+func TestSetAnalysisFolderFilesForTheMemberOnly(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.PUT("/api/analyses/:id/folder", setAnalysisFolderHandler)
+
+	// testUser is an editor of someone else's analysis.
+	expectRole(mock, "editor")
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(3, testUser.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT INTO user_analysis_folders").
+		WithArgs(testUser.ID, 7, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := serve(r, http.MethodPut, "/api/analyses/7/folder", `{"folderId": 3}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
+
+func TestSetAnalysisFolderRejectsOthersFolders(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.PUT("/api/analyses/:id/folder", setAnalysisFolderHandler)
+
+	expectRole(mock, "owner")
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(3, testUser.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	w := serve(r, http.MethodPut, "/api/analyses/7/folder", `{"folderId": 3}`)
+
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
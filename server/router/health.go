@@ -0,0 +1,48 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/gin-gonic/gin"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// draining fails readiness once shutdown starts, so load balancers stop
+// sending requests while in-flight ones finish.
+var draining atomic.Bool
+
+// Drain marks the server as shutting down.
+func Drain() {
+	draining.Store(true)
+}
+
+// livezHandler reports that the process is up. It does not check dependencies,
+// so an unreachable database does not get the server restarted.
+func livezHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler reports whether the server can take traffic: it is not
+// shutting down, Postgres answers and the schema has been migrated.
+func readyzHandler(c *gin.Context) {
+	if draining.Load() {
+		apierror.Abort(c, apierror.New(http.StatusServiceUnavailable, "Shutting down"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := database.Ready(ctx); err != nil {
+		apierror.Abort(c, apierror.Wrap(err, http.StatusServiceUnavailable, "Database is not ready"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "schemaVersion": database.SchemaVersion})
+}
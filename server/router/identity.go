@@ -0,0 +1,87 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/ZacharyWM/greek-study-tool/server/auth/devissuer"
+	"github.com/gin-gonic/gin"
+)
+
+// newIdentityProvider sets up the configured OpenID Connect provider. With
+// OIDC_DEV_ISSUER=true it instead serves the development issuer from this
+// server, under the path of OIDC_ISSUER_URL (by default /dev-issuer/), and
+// talks to it in-process so no network access is needed. Since it signs anyone
+// in, it is refused in release mode and unless both the issuer and the
+// callback URL are on a loopback host, which a deployment reachable by others
+// would not use.
+func newIdentityProvider(r *gin.Engine) (auth.IdentityProvider, error) {
+	config := auth.ConfigFromEnv()
+
+	if os.Getenv("OIDC_DEV_ISSUER") == "true" {
+		if gin.Mode() == gin.ReleaseMode {
+			return nil, errors.New("OIDC_DEV_ISSUER must not be enabled in release mode")
+		}
+
+		if os.Getenv("OIDC_ISSUER_URL") == "" {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8080"
+			}
+			config.IssuerURL = "http://localhost:" + port + "/dev-issuer/"
+		}
+
+		urls := []struct{ name, value string }{
+			{"OIDC_ISSUER_URL", config.IssuerURL},
+			{"OIDC_CALLBACK_URL", config.CallbackURL},
+		}
+		for _, u := range urls {
+			if !isLoopbackURL(u.value) {
+				return nil, fmt.Errorf("OIDC_DEV_ISSUER needs %s on localhost or a loopback address, not %q", u.name, u.value)
+			}
+		}
+
+		issuerURL, err := url.Parse(config.IssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid issuer URL: %w", err)
+		}
+		mountPath := strings.TrimSuffix(issuerURL.Path, "/")
+		if mountPath == "" {
+			return nil, errors.New("the dev issuer needs a path in OIDC_ISSUER_URL, such as /dev-issuer/")
+		}
+
+		issuer, err := devissuer.New(config.IssuerURL, config.ClientID, config.Audience, os.Getenv("OIDC_DEV_ISSUER_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("error creating the dev issuer: %w", err)
+		}
+
+		r.Any(mountPath+"/*path", gin.WrapH(issuer.Handler()))
+		config.HTTPClient = issuer.Client()
+
+		slog.Warn("Serving the development OIDC issuer; anyone can sign in", "issuer", config.IssuerURL)
+	}
+
+	return auth.New(context.Background(), config)
+}
+
+// isLoopbackURL reports whether the URL's host is localhost or a loopback IP.
+func isLoopbackURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDevIssuerNeedsLoopbackURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuer   string
+		callback string
+		want     string
+	}{
+		{"public callback", "", "https://zachm.dev/callback", "OIDC_CALLBACK_URL"},
+		{"public issuer", "https://zachm.dev/dev-issuer/", "http://localhost:8080/callback", "OIDC_ISSUER_URL"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.DebugMode)
+			t.Cleanup(func() { gin.SetMode(gin.TestMode) })
+			t.Setenv("OIDC_DEV_ISSUER", "true")
+			t.Setenv("OIDC_ISSUER_URL", test.issuer)
+			t.Setenv("OIDC_CALLBACK_URL", test.callback)
+
+			_, err := newIdentityProvider(gin.New())
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("err = %v, want it to name %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestIsLoopbackURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://localhost:8080/callback", true},
+		{"http://app.localhost/callback", true},
+		{"http://127.0.0.1:8080/dev-issuer/", true},
+		{"http://[::1]:8080/callback", true},
+		{"https://zachm.dev/callback", false},
+		{"http://10.0.0.5/callback", false},
+		{"http://localhost.example.com/callback", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := isLoopbackURL(test.url); got != test.want {
+			t.Errorf("isLoopbackURL(%q) = %v, want %v", test.url, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/middleware"
+	"github.com/ZacharyWM/greek-study-tool/server/realtime"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// liveHub connects everyone who has the same analysis open.
+var liveHub = realtime.NewHub()
+
+// CloseLive disconnects live editing clients and waits for them to go away.
+// Their connections are hijacked, so http.Server.Shutdown does not wait for
+// them.
+func CloseLive(ctx context.Context) error {
+	return liveHub.Close(ctx)
+}
+
+// liveAnalysisHandler upgrades to a WebSocket and joins the analysis room.
+// Viewers receive operations and presence; editors and owners can also submit.
+func liveAnalysisHandler(hub *realtime.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.UserFromContext(c)
+
+		analysisID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+			return
+		}
+
+		role, err := service.GetAnalysisRole(c.Request.Context(), analysisID, user.ID)
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// Upgrade has already written an error response.
+			slog.Warn("Failed to upgrade websocket", "error", err)
+			return
+		}
+
+		// The role is looked up again for every operation, since a member
+		// can be removed or demoted while connected.
+		ctx := c.Request.Context()
+		client := hub.Join(analysisID, realtime.Participant{
+			UserID:  user.ID,
+			Name:    user.Name,
+			CanEdit: role.CanEdit(),
+			Authorize: func() (bool, error) {
+				role, err := service.GetAnalysisRole(ctx, analysisID, user.ID)
+				if errors.Is(err, service.ErrNotFound) {
+					return false, realtime.ErrNoAccess
+				}
+				if err != nil {
+					return false, err
+				}
+				return role.CanEdit(), nil
+			},
+		})
+
+		realtime.ServeWebSocket(conn, client)
+	}
+}
+
+func getPresenceHandler(hub *realtime.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := currentUserID(c)
+
+		analysisID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+			return
+		}
+
+		if _, err := service.GetAnalysisRole(c.Request.Context(), analysisID, userID); err != nil {
+			apierror.Abort(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, hub.Presence(analysisID))
+	}
+}
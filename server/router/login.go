@@ -5,30 +5,41 @@ import (
 	"encoding/base64"
 	"net/http"
 
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/auth"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-
-	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"golang.org/x/oauth2"
 )
 
 // loginHandler for our login.
-func loginHandler(auth *auth.Authenticator) gin.HandlerFunc {
+func loginHandler(idp auth.IdentityProvider) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		state, err := generateRandomState()
 		if err != nil {
-			ctx.String(http.StatusInternalServerError, err.Error())
+			apierror.Abort(ctx, apierror.FromError(http.StatusInternalServerError, err))
+			return
+		}
+
+		nonce, err := generateRandomState()
+		if err != nil {
+			apierror.Abort(ctx, apierror.FromError(http.StatusInternalServerError, err))
 			return
 		}
 
-		// Save the state inside the session.
+		verifier := oauth2.GenerateVerifier()
+
+		// Save the state, nonce and PKCE verifier inside the session for the callback.
 		session := sessions.Default(ctx)
-		session.Set("state", state)
+		session.Set(auth.SessionState, state)
+		session.Set(auth.SessionNonce, nonce)
+		session.Set(auth.SessionVerifier, verifier)
 		if err := session.Save(); err != nil {
-			ctx.String(http.StatusInternalServerError, err.Error())
+			apierror.Abort(ctx, apierror.FromError(http.StatusInternalServerError, err))
 			return
 		}
 
-		ctx.Redirect(http.StatusTemporaryRedirect, auth.AuthCodeURL(state))
+		ctx.Redirect(http.StatusTemporaryRedirect, idp.LoginURL(state, nonce, verifier))
 	}
 }
 
@@ -39,7 +50,7 @@ func generateRandomState() (string, error) {
 		return "", err
 	}
 
-	state := base64.StdEncoding.EncodeToString(b)
+	state := base64.RawURLEncoding.EncodeToString(b)
 
 	return state, nil
 }
@@ -2,35 +2,38 @@ package router
 
 import (
 	"net/http"
-	"net/url"
 
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
 	auth "github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
-// logoutHandler for our logout.
-func logoutHandler(ctx *gin.Context) {
-	logoutUrl, err := url.Parse("https://" + auth.AUTH0_DOMAIN + "/v2/logout")
-	if err != nil {
-		ctx.String(http.StatusInternalServerError, err.Error())
-		return
-	}
+// logoutHandler ends the browser session and logs out of the identity provider
+// when it supports RP-initiated logout.
+func logoutHandler(idp auth.IdentityProvider) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		session := sessions.Default(ctx)
+		idTokenHint, _ := session.Get(auth.SessionIDToken).(string)
 
-	scheme := "http"
-	if ctx.Request.TLS != nil {
-		scheme = "https"
-	}
+		session.Clear()
+		session.Options(sessions.Options{Path: "/", MaxAge: -1})
+		if err := session.Save(); err != nil {
+			apierror.Abort(ctx, apierror.FromError(http.StatusInternalServerError, err))
+			return
+		}
 
-	returnTo, err := url.Parse(scheme + "://" + ctx.Request.Host)
-	if err != nil {
-		ctx.String(http.StatusInternalServerError, err.Error())
-		return
-	}
+		scheme := "http"
+		if ctx.Request.TLS != nil {
+			scheme = "https"
+		}
+		returnTo := scheme + "://" + ctx.Request.Host + "/"
 
-	parameters := url.Values{}
-	parameters.Add("returnTo", returnTo.String())
-	parameters.Add("client_id", auth.AUTH0_CLIENT_ID)
-	logoutUrl.RawQuery = parameters.Encode()
+		logoutURL := idp.LogoutURL(returnTo, idTokenHint)
+		if logoutURL == "" {
+			logoutURL = "/"
+		}
 
-	ctx.Redirect(http.StatusTemporaryRedirect, logoutUrl.String())
+		ctx.Redirect(http.StatusTemporaryRedirect, logoutURL)
+	}
 }
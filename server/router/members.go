@@ -0,0 +1,115 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+type inviteMemberRequest struct {
+	Email string               `json:"email" binding:"required,email"`
+	Role  service.AnalysisRole `json:"role" binding:"required"`
+}
+
+type updateMemberRequest struct {
+	Role service.AnalysisRole `json:"role" binding:"required"`
+}
+
+func getMembersHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	members, err := service.GetAnalysisMembers(c.Request.Context(), analysisID, userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+func inviteMemberHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	var req inviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	member, err := service.InviteAnalysisMember(c.Request.Context(), analysisID, userID, req.Email, req.Role)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func updateMemberHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid user ID"))
+		return
+	}
+
+	var req updateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	err = service.UpdateAnalysisMemberRole(c.Request.Context(), analysisID, userID, memberID, req.Role)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func removeMemberHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid user ID"))
+		return
+	}
+
+	err = service.RemoveAnalysisMember(c.Request.Context(), analysisID, userID, memberID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestInviteRejectsTheOwner(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.POST("/api/analyses/:id/members", inviteMemberHandler)
+
+	// Only the owner can invite, so inviting the owner is inviting yourself.
+	expectRole(mock, "owner")
+	mock.ExpectQuery("FROM users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).AddRow(testUser.ID, testUser.Name, "owner@example.com"))
+
+	w := serve(r, http.MethodPost, "/api/analyses/7/members", `{"email": "owner@example.com", "role": "editor"}`)
+
+	envelope := expectError(t, w, http.StatusBadRequest, "invalid_argument")
+	if want := "cannot invite yourself"; envelope.Error.Message != want {
+		t.Errorf("message = %q, want %q", envelope.Error.Message, want)
+	}
+}
+
+func TestMembersCannotBeMadeOwners(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"invite", http.MethodPost, "/api/analyses/7/members", `{"email": "bob@example.com", "role": "owner"}`},
+		{"change role", http.MethodPatch, "/api/analyses/7/members/2", `{"role": "owner"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter(t)
+			r.POST("/api/analyses/:id/members", inviteMemberHandler)
+			r.PATCH("/api/analyses/:id/members/:userId", updateMemberHandler)
+
+			w := serve(r, test.method, test.target, test.body)
+
+			envelope := expectError(t, w, http.StatusBadRequest, "invalid_argument")
+			if want := "role must be editor or viewer"; envelope.Error.Message != want {
+				t.Errorf("message = %q, want %q", envelope.Error.Message, want)
+			}
+		})
+	}
+}
+
+func TestSharingIsForOwners(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.GET("/api/analyses/:id/shares", getSharesHandler)
+
+	expectRole(mock, "editor")
+
+	w := serve(r, http.MethodGet, "/api/analyses/7/shares", "")
+
+	envelope := expectError(t, w, http.StatusForbidden, "permission_denied")
+	if want := "only owners can see the share links of this analysis"; envelope.Error.Message != want {
+		t.Errorf("message = %q, want %q", envelope.Error.Message, want)
+	}
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPreferencesSize bounds preference updates, which are small JSON objects.
+const maxPreferencesSize = 16 << 10
+
+func getPreferencesHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	preferences, err := service.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// updatePreferencesHandler changes the preferences present in the body and
+// leaves the rest as they are.
+func updatePreferencesHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	patch, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPreferencesSize))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusRequestEntityTooLarge, "Preferences are too large"))
+		return
+	}
+
+	preferences, err := service.UpdatePreferences(c.Request.Context(), userID, patch)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestUpdatePreferencesValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"removed preference", `{"lexicon": "strongs"}`, "invalid preferences"},
+		{"unknown layout preset", `{"layoutPreset": "wide"}`, "layoutPreset must be empty or one of"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, mock := newTestRouter(t)
+			r.PATCH("/api/me/preferences", updatePreferencesHandler)
+
+			mock.ExpectQuery("FROM user_preferences").WillReturnError(sql.ErrNoRows)
+
+			w := serve(r, http.MethodPatch, "/api/me/preferences", test.body)
+
+			envelope := expectError(t, w, http.StatusBadRequest, "invalid_argument")
+			if !strings.HasPrefix(envelope.Error.Message, test.message) {
+				t.Errorf("message = %q, want it to start with %q", envelope.Error.Message, test.message)
+			}
+		})
+	}
+}
+
+func TestUpdatePreferencesSavesLayoutPreset(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.PATCH("/api/me/preferences", updatePreferencesHandler)
+
+	mock.ExpectQuery("FROM user_preferences").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("INSERT INTO user_preferences").
+		WithArgs(testUser.ID, []byte(`{"parsingLabels":"abbreviated","greekFontSize":20,"layoutPreset":"greek"}`)).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+
+	w := serve(r, http.MethodPatch, "/api/me/preferences", `{"layoutPreset": "greek"}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
@@ -3,59 +3,153 @@ package router
 import (
 	"log"
 	"net/http"
-	"path"
+	"os"
+	"strings"
 
+	"github.com/ZacharyWM/greek-study-tool/frontend"
+	"github.com/ZacharyWM/greek-study-tool/server/assets"
 	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
 	"github.com/ZacharyWM/greek-study-tool/server/middleware"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/ZacharyWM/greek-study-tool/server/tracing"
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func New(appDir string) *gin.Engine {
-	r := gin.Default()
+// New builds the router. The frontend is served from the bundle embedded in
+// the binary, or from frontendDir on disk when it is set.
+func New(frontendDir string) *gin.Engine {
+	r := gin.New()
+	r.Use(
+		middleware.RequestID(),
+		middleware.AccessLog(),
+		middleware.Recovery(),
+		otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(traced)),
+		metrics.Middleware(),
+	)
 
-	appPath := path.Join(appDir, "frontend/build/App.js")
-	htmlPath := path.Join(appDir, "frontend/index.html")
+	static, err := assets.New(frontend.Bundle(frontendDir), frontendDir != "")
+	if err != nil {
+		log.Fatalf("Failed to load the frontend bundle: %v", err)
+	}
+	static.Register(r)
 
-	r.StaticFile("/assets/app.js", appPath)
-	r.StaticFile("/assets/output.css", path.Join(appDir, "frontend/build/style.css"))
-	r.StaticFile("/assets/SBLBibLit.ttf", path.Join(appDir, "frontend/build/SBLBibLit.ttf"))
-	r.StaticFile("/", htmlPath)
+	r.GET("/livez", livezHandler)
+	r.GET("/readyz", readyzHandler)
+	// /healthcheck predates the split and is kept for existing probes.
+	r.GET("/healthcheck", readyzHandler)
 
-	r.GET("/healthcheck", func(c *gin.Context) {
-		c.Status(http.StatusOK)
-	})
+	idp, err := newIdentityProvider(r)
+	if err != nil {
+		log.Fatalf("Failed to initialize the identity provider: %v", err)
+	}
 
-	auth, err := auth.New()
+	sessionStore, err := auth.NewSessionStore(database.DB)
 	if err != nil {
-		log.Fatalf("Failed to initialize the authenticator: %v", err)
+		log.Fatalf("Failed to initialize the session store: %v", err)
 	}
+	r.Use(sessions.Sessions(auth.SessionName, sessionStore))
 
-	r.GET("/login", loginHandler(auth))
-	r.GET("/callback", callbackHandler(auth))
-	r.GET("/logout", logoutHandler)
+	r.GET("/login", loginHandler(idp))
+	r.GET("/callback", callbackHandler(idp))
+	r.GET("/logout", logoutHandler(idp))
 
-	secureRouter := r.Group("/api", middleware.JwtAuth())
+	r.GET("/shared/:token", getSharedAnalysisHandler)
+
+	// LEGACY_LATEST_ANALYSIS keeps GET /api/analyses/0 returning the most
+	// recently updated analysis for older clients.
+	legacyLatest := os.Getenv("LEGACY_LATEST_ANALYSIS") == "true"
+
+	api := r.Group("/api")
+
+	// Routes on secureRouter need a browser session or JWT. The scoped groups
+	// also accept personal access tokens granted their scope.
+	secureRouter := api.Group("", middleware.SessionOrJwtAuth(idp))
+	readCorpusRouter := api.Group("", middleware.ScopedAuth(idp, service.ScopeReadCorpus))
+	readAnalysesRouter := api.Group("", middleware.ScopedAuth(idp, service.ScopeReadAnalyses))
+	writeAnalysesRouter := api.Group("", middleware.ScopedAuth(idp, service.ScopeWriteAnalyses))
 
 	secureRouter.GET("/user/:id", getUserHandler)
-	secureRouter.POST("/user", upsertUserHandler)
+	secureRouter.POST("/user", upsertUserHandler(idp))
+
+	readAnalysesRouter.GET("/me/export", exportAccountHandler)
+	secureRouter.POST("/me/import", importAccountHandler)
+	secureRouter.DELETE("/me", deleteAccountHandler)
+	secureRouter.POST("/me/deletion/cancel", cancelAccountDeletionHandler)
+	secureRouter.GET("/me/workspace", getWorkspaceHandler)
+	secureRouter.PUT("/me/workspace", saveWorkspaceHandler)
+	secureRouter.GET("/me/preferences", getPreferencesHandler)
+	secureRouter.PATCH("/me/preferences", updatePreferencesHandler)
+	secureRouter.GET("/me/tokens", getAccessTokensHandler)
+	secureRouter.POST("/me/tokens", createAccessTokenHandler)
+	secureRouter.DELETE("/me/tokens/:tokenId", deleteAccessTokenHandler)
 
-	secureRouter.POST("/analyses", createAnalysisHandler)
-	secureRouter.PATCH("/analyses/:id", updateAnalysisHandler)
-	secureRouter.GET("/analyses/:id", getAnalysisHandler)
-	secureRouter.GET("/analyses", getUserAnalysesHandler)
-	secureRouter.DELETE("/analyses/:id", deleteAnalysisHandler)
+	writeAnalysesRouter.POST("/analyses", createAnalysisHandler)
+	writeAnalysesRouter.POST("/analyses/from-passage", createAnalysisFromPassageHandler)
+	writeAnalysesRouter.PATCH("/analyses/:id", updateAnalysisHandler)
+	readAnalysesRouter.GET("/analyses/latest", getLatestAnalysisHandler)
+	readAnalysesRouter.GET("/analyses/:id", getAnalysisHandler(legacyLatest))
+	readAnalysesRouter.GET("/analyses", getUserAnalysesHandler)
+	writeAnalysesRouter.DELETE("/analyses/:id", deleteAnalysisHandler)
+	readAnalysesRouter.GET("/analyses/trash", getTrashHandler)
+	writeAnalysesRouter.POST("/analyses/:id/restore", restoreAnalysisHandler)
+	readAnalysesRouter.GET("/analyses/:id/export.pdf", exportAnalysisPDFHandler)
+	readAnalysesRouter.GET("/analyses/:id/export", exportAnalysisHandler)
+	writeAnalysesRouter.POST("/analyses/:id/duplicate", duplicateAnalysisHandler)
 
-	secureRouter.GET("/books", getBooksHandler)
-	secureRouter.GET("/books/:bookId/chapters", getChaptersHandler)
-	secureRouter.GET("/chapters/:chapterId/verses", getVersesHandler)
-	secureRouter.GET("/verses", getVersesHandlerWithWords)
+	readAnalysesRouter.GET("/templates", getTemplatesHandler)
+	secureRouter.POST("/templates", createTemplateHandler)
+	secureRouter.DELETE("/templates/:templateId", deleteTemplateHandler)
+	secureRouter.POST("/templates/shared", middleware.RequireRole(service.UserRoleTeacher), publishTemplateHandler)
 
-	secureRouter.GET("/strongs/:code", getStrongsWordHandler)
-	secureRouter.GET("/word/:text/strongs", getStrongsWordByTextHandler)
+	secureRouter.POST("/analyses/:id/share", createShareHandler)
+	secureRouter.GET("/analyses/:id/shares", getSharesHandler)
+	secureRouter.DELETE("/analyses/:id/shares/:shareId", deleteShareHandler)
 
-	r.NoRoute(func(c *gin.Context) {
-		c.File(path.Join(appDir, "frontend/index.html"))
-	})
+	writeAnalysesRouter.PUT("/analyses/:id/tags", setAnalysisTagsHandler)
+	writeAnalysesRouter.PUT("/analyses/:id/folder", setAnalysisFolderHandler)
+	readAnalysesRouter.GET("/tags", getTagsHandler)
+	readAnalysesRouter.GET("/folders", getFoldersHandler)
+	secureRouter.POST("/folders", createFolderHandler)
+	secureRouter.PATCH("/folders/:folderId", renameFolderHandler)
+	secureRouter.DELETE("/folders/:folderId", deleteFolderHandler)
+
+	secureRouter.GET("/analyses/:id/members", getMembersHandler)
+	secureRouter.POST("/analyses/:id/members", inviteMemberHandler)
+	secureRouter.PATCH("/analyses/:id/members/:userId", updateMemberHandler)
+	secureRouter.DELETE("/analyses/:id/members/:userId", removeMemberHandler)
+
+	secureRouter.GET("/analyses/:id/live", liveAnalysisHandler(liveHub))
+	secureRouter.GET("/analyses/:id/presence", getPresenceHandler(liveHub))
+
+	readCorpusRouter.GET("/books", getBooksHandler)
+	readCorpusRouter.GET("/books/:bookId/chapters", getChaptersHandler)
+	readCorpusRouter.GET("/chapters/:chapterId/verses", getVersesHandler)
+	readCorpusRouter.GET("/verses", getVersesHandlerWithWords)
+	readAnalysesRouter.GET("/verses/:id/analyses", getVerseAnalysesHandler)
+
+	readCorpusRouter.GET("/strongs/:code", getStrongsWordHandler)
+	readCorpusRouter.GET("/word/:text/strongs", getStrongsWordByTextHandler)
+
+	adminRouter := secureRouter.Group("/admin", middleware.RequireRole(service.UserRoleAdmin))
+	adminRouter.GET("/users", adminListUsersHandler)
+	adminRouter.GET("/users/:userId/usage", adminGetUserUsageHandler)
+	adminRouter.PUT("/users/:userId/role", adminSetUserRoleHandler)
+	adminRouter.POST("/users/:userId/disable", adminSetUserDisabledHandler(true))
+	adminRouter.POST("/users/:userId/enable", adminSetUserDisabledHandler(false))
+	adminRouter.POST("/analyses/:id/reassign", adminReassignAnalysisHandler)
 
 	return r
 }
+
+// traced leaves probes and static assets out of traces.
+func traced(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/livez", "/readyz", "/healthcheck":
+		return false
+	}
+	return !strings.HasPrefix(r.URL.Path, "/assets/")
+}
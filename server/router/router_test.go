@@ -0,0 +1,124 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/middleware"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// testUser is who requests made with newTestRouter are signed in as.
+var testUser = service.User{ID: 1, Name: "Test User", Role: service.UserRoleUser}
+
+// newTestRouter returns an engine with the request ID middleware and testUser
+// signed in, and points the database at a mock for the duration of the test.
+// Routes are registered by the caller.
+func newTestRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating mock database: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	r := gin.New()
+	r.Use(middleware.RequestID(), func(c *gin.Context) {
+		// The key middleware.UserFromContext reads the user from.
+		c.Set("user", testUser)
+	})
+
+	return r, mock
+}
+
+// apiError is the error envelope as a client decodes it.
+type apiError struct {
+	Error struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"requestId"`
+	} `json:"error"`
+}
+
+func serve(r *gin.Engine, method string, target string, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// serveWithToken serves a request carrying a bearer token, as the frontend
+// sends.
+func serveWithToken(r *gin.Engine, method string, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// expectError checks that the response is the error envelope with the given
+// status and code, and that it carries the request ID.
+func expectError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) apiError {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, status, w.Body)
+	}
+
+	var envelope apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("decoding error envelope: %v; body: %s", err, w.Body)
+	}
+	if envelope.Error.Code != code {
+		t.Errorf("code = %q, want %q", envelope.Error.Code, code)
+	}
+	if envelope.Error.Message == "" {
+		t.Error("message is empty")
+	}
+	if envelope.Error.RequestID == "" || envelope.Error.RequestID != w.Header().Get(middleware.RequestIDHeader) {
+		t.Errorf("requestId = %q, want the X-Request-ID header %q", envelope.Error.RequestID, w.Header().Get(middleware.RequestIDHeader))
+	}
+
+	return envelope
+}
+
+func TestUnknownErrorsAreInternal(t *testing.T) {
+	r, mock := newTestRouter(t)
+	r.DELETE("/api/analyses/:id", deleteAnalysisHandler)
+
+	mock.ExpectExec("UPDATE analyses SET deleted_at").WillReturnError(io.ErrUnexpectedEOF)
+
+	w := serve(r, http.MethodDelete, "/api/analyses/7", "")
+
+	envelope := expectError(t, w, http.StatusInternalServerError, "internal")
+	if envelope.Error.Message != "Internal server error" {
+		t.Errorf("message = %q, want the generic message", envelope.Error.Message)
+	}
+}
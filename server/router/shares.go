@@ -0,0 +1,106 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+type createShareRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func createShareHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	// The body is optional; an empty body creates a link without expiry.
+	var req createShareRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+			return
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "expiresAt must be in the future"))
+		return
+	}
+
+	share, err := service.CreateAnalysisShare(c.Request.Context(), analysisID, userID, req.ExpiresAt)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, share)
+}
+
+func getSharesHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	shares, err := service.GetAnalysisShares(c.Request.Context(), analysisID, userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, shares)
+}
+
+func deleteShareHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	shareID, err := strconv.Atoi(c.Param("shareId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid share ID"))
+		return
+	}
+
+	err = service.DeleteAnalysisShare(c.Request.Context(), shareID, analysisID, userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// getSharedAnalysisHandler is public; the token itself is the credential.
+func getSharedAnalysisHandler(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "token is required"))
+		return
+	}
+
+	analysis, err := service.GetSharedAnalysis(c.Request.Context(), token)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
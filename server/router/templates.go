@@ -0,0 +1,113 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+type duplicateAnalysisRequest struct {
+	Title string `json:"title"`
+}
+
+type templateRequest struct {
+	AnalysisID int    `json:"analysisId" binding:"required"`
+	Name       string `json:"name" binding:"required"`
+}
+
+func duplicateAnalysisHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	analysisID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid analysis ID"))
+		return
+	}
+
+	// The body is optional; without one the copy gets a default title.
+	var req duplicateAnalysisRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+			return
+		}
+	}
+
+	analysis, err := service.DuplicateAnalysis(c.Request.Context(), analysisID, userID, req.Title)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, analysis)
+}
+
+func getTemplatesHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	templates, err := service.GetTemplates(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func createTemplateHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	template, err := service.CreateTemplate(c.Request.Context(), userID, req.AnalysisID, req.Name)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, template)
+}
+
+// publishTemplateHandler creates a template shared with every user. Only
+// teachers and administrators are routed here.
+func publishTemplateHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	template, err := service.PublishTemplate(c.Request.Context(), userID, req.AnalysisID, req.Name)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, template)
+}
+
+func deleteTemplateHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	templateID, err := strconv.Atoi(c.Param("templateId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid template ID"))
+		return
+	}
+
+	if err := service.DeleteTemplate(c.Request.Context(), templateID, userID); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,56 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ZacharyWM/greek-study-tool/server/middleware"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+const templateBody = `{"analysisId": 7, "name": "Class setup"}`
+
+// signInAs replaces testUser with a user of the given role.
+func signInAs(r *gin.Engine, role service.UserRole) {
+	user := testUser
+	user.Role = role
+	r.Use(func(c *gin.Context) {
+		c.Set("user", user)
+	})
+}
+
+func TestPublishTemplateRequiresTeacher(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.POST("/api/templates/shared", middleware.RequireRole(service.UserRoleTeacher), publishTemplateHandler)
+
+	w := serve(r, http.MethodPost, "/api/templates/shared", templateBody)
+
+	expectError(t, w, http.StatusForbidden, "permission_denied")
+}
+
+func TestTeachersPublishSharedTemplates(t *testing.T) {
+	r, mock := newTestRouter(t)
+	signInAs(r, service.UserRoleTeacher)
+	r.POST("/api/templates/shared", middleware.RequireRole(service.UserRoleTeacher), publishTemplateHandler)
+
+	expectAnalysis(mock, 7)
+	mock.ExpectQuery("INSERT INTO analysis_templates").
+		WithArgs(nil, "Class setup", sqlmock.AnyArg(), 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, "2026-01-03"))
+
+	w := serve(r, http.MethodPost, "/api/templates/shared", templateBody)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	var template service.AnalysisTemplate
+	if err := json.Unmarshal(w.Body.Bytes(), &template); err != nil {
+		t.Fatal(err)
+	}
+	if template.UserID != nil {
+		t.Errorf("userId = %d, want a shared template", *template.UserID)
+	}
+}
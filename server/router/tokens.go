@@ -0,0 +1,65 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+type createAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+func getAccessTokensHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	tokens, err := service.GetAccessTokens(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// createAccessTokenHandler returns the new token with its secret, which cannot
+// be retrieved again.
+func createAccessTokenHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var req createAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	token, secret, err := service.CreateAccessToken(c.Request.Context(), userID, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "secret": secret})
+}
+
+func deleteAccessTokenHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	tokenID, err := strconv.Atoi(c.Param("tokenId"))
+	if err != nil {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid token ID"))
+		return
+	}
+
+	if err := service.DeleteAccessToken(c.Request.Context(), tokenID, userID); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -1,13 +1,13 @@
 package router
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
 	"github.com/ZacharyWM/greek-study-tool/server/auth"
-	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/middleware"
 	"github.com/ZacharyWM/greek-study-tool/server/service"
 	"github.com/gin-gonic/gin"
 )
@@ -18,109 +18,71 @@ type User struct {
 	Name string `json:"name"`
 }
 
-type Auth0UserInfo struct {
-	Sub           string `json:"sub"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
-	Nickname      string `json:"nickname"`
-	Name          string `json:"name"`
-	Picture       string `json:"picture"`
-	UpdatedAt     string `json:"updated_at"`
-	Email         string `json:"email"`
-	EmailVerified bool   `json:"email_verified"`
-}
-
-// upsertUserHandler for the user endpoint
-func upsertUserHandler(c *gin.Context) {
-	ctx := c.Request.Context()
-	jwt := c.GetHeader("Authorization")
-
-	userInfo, err := getAuth0UserInfo(jwt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	user, err := service.GetUserByIdpID(ctx, userInfo.Sub)
-
-	upsertUser := service.User{
-		IdpID:         userInfo.Sub,
-		FirstName:     userInfo.GivenName,
-		LastName:      userInfo.FamilyName,
-		Nickname:      userInfo.Nickname,
-		Name:          userInfo.Name,
-		Picture:       userInfo.Picture,
-		Email:         userInfo.Email,
-		EmailVerified: userInfo.EmailVerified,
-	}
-
-	insert := err != nil || user.ID == 0
+// upsertUserHandler fills in the user's profile from the identity provider's
+// userinfo endpoint. The user itself is already provisioned by the auth
+// middleware, but from access token claims: tokens issued for an API usually
+// carry little more than the subject, since providers keep name, email and
+// picture to the ID token and userinfo. So userinfo is asked on first login,
+// and again once the profile is older than service.ProfileRefreshInterval;
+// otherwise the frontend's call on every page load costs no round trip.
+// Browser sessions have no access token and keep the profile from login.
+func upsertUserHandler(idp auth.IdentityProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		user := middleware.UserFromContext(c)
+
+		authHeader := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") || !user.ProfileStale() {
+			c.JSON(http.StatusOK, gin.H{"userId": user.ID})
+			return
+		}
 
-	if insert {
-		userID, err := service.InsertUser(ctx, upsertUser)
+		userInfo, err := idp.UserInfo(ctx, strings.TrimPrefix(authHeader, "Bearer "))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			apierror.Abort(c, apierror.FromError(http.StatusInternalServerError, err))
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"userId": userID})
-		return
-	}
+		err = service.UpdateUserByIdpID(ctx, service.User{
+			IdpID:         user.IdpID,
+			FirstName:     userInfo.GivenName,
+			LastName:      userInfo.FamilyName,
+			Nickname:      userInfo.Nickname,
+			Name:          userInfo.Name,
+			Picture:       userInfo.Picture,
+			Email:         userInfo.Email,
+			EmailVerified: userInfo.EmailVerified,
+		})
+		if err != nil {
+			apierror.Abort(c, apierror.FromError(http.StatusInternalServerError, err))
+			return
+		}
 
-	err = service.UpdateUserByIdpID(ctx, upsertUser)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		c.JSON(http.StatusOK, gin.H{"userId": user.ID})
 	}
-
-	c.JSON(http.StatusOK, gin.H{"userId": user.ID})
 }
 
-// getAuth0UserInfo fetches the user information from Auth0's userinfo endpoint
-func getAuth0UserInfo(jwt string) (Auth0UserInfo, error) {
-	var userInfo Auth0UserInfo
-
-	req, err := http.NewRequest("GET", auth.AUTH0_USER_INFO_URL, nil)
-	if err != nil {
-		return userInfo, fmt.Errorf("error creating request: %w", err)
-	}
-
-	req.Header.Add("Authorization", jwt)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return userInfo, fmt.Errorf("error making request to Auth0: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return userInfo, fmt.Errorf("received non-200 response from Auth0: %d, body: %s", resp.StatusCode, string(body))
-	}
+// getUserHandler returns a user's name. Users can only look themselves up,
+// unless they are admins.
+func getUserHandler(c *gin.Context) {
+	currentUser := middleware.UserFromContext(c)
 
-	body, err := io.ReadAll(resp.Body)
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return userInfo, fmt.Errorf("error reading response body: %w", err)
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, "Invalid user ID"))
+		return
 	}
 
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		return userInfo, fmt.Errorf("error parsing user info JSON: %w", err)
+	if id != currentUser.ID && !currentUser.IsAdmin() {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, "Forbidden"))
+		return
 	}
 
-	return userInfo, nil
-}
-
-func getUserHandler(c *gin.Context) {
-	id := c.Param("id")
-
-	// TODO - move to a data/service layer
-	var user User
-	err := database.DB.QueryRow("SELECT id, name FROM users WHERE id = $1", id).Scan(&user.ID, &user.Name)
+	user, err := service.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		apierror.Abort(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, User{ID: user.ID, Name: user.Name})
 }
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ZacharyWM/greek-study-tool/server/auth"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// userInfoCounter is an identity provider that only answers userinfo, and
+// counts how often it is asked.
+type userInfoCounter struct {
+	auth.IdentityProvider
+	calls int
+}
+
+func (p *userInfoCounter) UserInfo(ctx context.Context, accessToken string) (auth.Profile, error) {
+	p.calls++
+	return auth.Profile{Subject: "idp|1", Name: "Test User", Email: "test@example.com"}, nil
+}
+
+func TestUpsertUserOnlyFetchesStaleProfiles(t *testing.T) {
+	fresh := time.Now().Add(-time.Hour)
+	stale := time.Now().Add(-service.ProfileRefreshInterval - time.Hour)
+
+	tests := []struct {
+		name        string
+		refreshedAt *time.Time
+		calls       int
+	}{
+		{"first login", nil, 1},
+		{"stale profile", &stale, 1},
+		{"fresh profile", &fresh, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, mock := newTestRouter(t)
+			idp := &userInfoCounter{}
+
+			user := testUser
+			user.IdpID = "idp|1"
+			user.ProfileRefreshedAt = test.refreshedAt
+			r.POST("/api/user", func(c *gin.Context) { c.Set("user", user) }, upsertUserHandler(idp))
+
+			if test.calls > 0 {
+				mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			w := serveWithToken(r, http.MethodPost, "/api/user")
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if idp.calls != test.calls {
+				t.Errorf("userinfo calls = %d, want %d", idp.calls, test.calls)
+			}
+		})
+	}
+}
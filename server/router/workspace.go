@@ -0,0 +1,39 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/ZacharyWM/greek-study-tool/server/apierror"
+	"github.com/ZacharyWM/greek-study-tool/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func getWorkspaceHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	workspace, err := service.GetWorkspace(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+func saveWorkspaceHandler(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var workspace service.Workspace
+	if err := c.ShouldBindJSON(&workspace); err != nil {
+		apierror.Abort(c, apierror.FromError(http.StatusBadRequest, err))
+		return
+	}
+
+	workspace, err := service.SaveWorkspace(c.Request.Context(), userID, workspace)
+	if err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+)
+
+// ArchiveVersion is written to the manifest of every account export so later
+// versions of the importer can tell which layout they are reading.
+const ArchiveVersion = 1
+
+// maxArchiveEntrySize bounds how much of a single archive entry is read on import.
+const maxArchiveEntrySize = 10 << 20
+
+type ArchiveManifest struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Analyses   int       `json:"analyses"`
+}
+
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created"
+	ImportSkipped ImportStatus = "skipped"
+	ImportFailed  ImportStatus = "failed"
+)
+
+// ImportItem reports what happened to one item of an import. SourceID is the
+// analysis ID in the exporting instance; ID is the newly created analysis.
+type ImportItem struct {
+	Name     string       `json:"name"`
+	SourceID int          `json:"sourceId,omitempty"`
+	ID       int          `json:"id,omitempty"`
+	Status   ImportStatus `json:"status"`
+	Reason   string       `json:"reason,omitempty"`
+}
+
+type ImportReport struct {
+	Created int          `json:"created"`
+	Skipped int          `json:"skipped"`
+	Failed  int          `json:"failed"`
+	Items   []ImportItem `json:"items"`
+}
+
+func (r *ImportReport) add(item ImportItem) {
+	switch item.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportSkipped:
+		r.Skipped++
+	case ImportFailed:
+		r.Failed++
+	}
+	r.Items = append(r.Items, item)
+}
+
+// AccountExport is the account data that is loaded before an export starts
+// streaming, so that failures to load it can still be reported to the client.
+// The archive holds the profile, preferences and analyses; there is no other
+// per-user data to export.
+type AccountExport struct {
+	userID      int
+	user        User
+	preferences Preferences
+	summaries   []Analysis
+}
+
+// LoadAccountExport loads the user's profile, preferences and the list of
+// analyses the user can open.
+func LoadAccountExport(ctx context.Context, userID int) (*AccountExport, error) {
+	user, err := GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences, err := GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries, err := GetAnalysesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountExport{userID: userID, user: user, preferences: preferences, summaries: summaries}, nil
+}
+
+// Write writes a zip archive with the profile and preferences, a manifest and
+// every analysis, one JSON file per analysis. Analyses are loaded in full as
+// they are written.
+func (e *AccountExport) Write(ctx context.Context, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	manifest := ArchiveManifest{
+		Version:    ArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Analyses:   len(e.summaries),
+	}
+	if err := writeArchiveJSON(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+
+	if err := writeArchiveJSON(archive, "profile.json", e.user); err != nil {
+		return err
+	}
+
+	if err := writeArchiveJSON(archive, "preferences.json", e.preferences); err != nil {
+		return err
+	}
+
+	for _, summary := range e.summaries {
+		analysis, err := GetAnalysisById(ctx, summary.ID, e.userID)
+		if err != nil {
+			return fmt.Errorf("error loading analysis %d: %w", summary.ID, err)
+		}
+
+		name := fmt.Sprintf("analyses/%d.json", analysis.ID)
+		if err := writeArchiveJSON(archive, name, analysis); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeArchiveJSON(archive *zip.Writer, name string, value interface{}) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("error creating %s in archive: %w", name, err)
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("error writing %s to archive: %w", name, err)
+	}
+
+	return nil
+}
+
+// ImportAccount imports an account export or a single analysis JSON document
+// into the user's account. Imported analyses always get new IDs and belong to
+// the importing user; an analysis identical to one the user already owns is
+// skipped. Preferences are restored, but profile data is not imported since it
+// comes from the identity provider.
+func ImportAccount(ctx context.Context, userID int, data []byte) (ImportReport, error) {
+	var report ImportReport
+
+	if bytes.HasPrefix(data, []byte("PK")) {
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return report, invalid("archive is not a valid zip: %v", err)
+		}
+
+		if err := checkArchiveManifest(archive); err != nil {
+			return report, err
+		}
+
+		for _, f := range archive.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+
+			if f.Name == "preferences.json" {
+				report.add(importPreferences(ctx, userID, f))
+				continue
+			}
+
+			if !strings.HasPrefix(f.Name, "analyses/") || path.Ext(f.Name) != ".json" {
+				if f.Name != "manifest.json" {
+					report.add(ImportItem{Name: f.Name, Status: ImportSkipped, Reason: "not an analysis"})
+				}
+				continue
+			}
+
+			entry, err := readArchiveEntry(f)
+			if err != nil {
+				report.add(ImportItem{Name: f.Name, Status: ImportFailed, Reason: err.Error()})
+				continue
+			}
+
+			report.add(importAnalysis(ctx, userID, f.Name, entry))
+		}
+
+		return report, nil
+	}
+
+	if !json.Valid(data) {
+		return report, invalid("import must be a zip archive or an analysis JSON document")
+	}
+
+	report.add(importAnalysis(ctx, userID, "analysis.json", data))
+	return report, nil
+}
+
+func checkArchiveManifest(archive *zip.Reader) error {
+	for _, f := range archive.File {
+		if f.Name != "manifest.json" {
+			continue
+		}
+
+		data, err := readArchiveEntry(f)
+		if err != nil {
+			return invalid("manifest.json could not be read: %v", err)
+		}
+
+		var manifest ArchiveManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return invalid("manifest.json is not valid: %v", err)
+		}
+
+		if manifest.Version > ArchiveVersion {
+			return invalid("archive version %d is newer than supported version %d", manifest.Version, ArchiveVersion)
+		}
+
+		return nil
+	}
+
+	return invalid("archive has no manifest.json")
+}
+
+func readArchiveEntry(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxArchiveEntrySize {
+		return nil, invalid("file is too large")
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(io.LimitReader(rc, maxArchiveEntrySize))
+}
+
+// importPreferences restores exported preferences over the user's current ones.
+func importPreferences(ctx context.Context, userID int, f *zip.File) ImportItem {
+	item := ImportItem{Name: f.Name}
+
+	entry, err := readArchiveEntry(f)
+	if err != nil {
+		item.Status, item.Reason = ImportFailed, err.Error()
+		return item
+	}
+
+	// The export includes when the preferences were last saved, which is not
+	// a preference itself.
+	var preferences Preferences
+	if err := json.Unmarshal(entry, &preferences); err != nil {
+		item.Status, item.Reason = ImportFailed, "invalid preferences"
+		return item
+	}
+	preferences.UpdatedAt = nil
+	patch, err := json.Marshal(preferences)
+	if err != nil {
+		item.Status, item.Reason = ImportFailed, err.Error()
+		return item
+	}
+
+	if _, err := UpdatePreferences(ctx, userID, patch); err != nil {
+		item.Status, item.Reason = ImportFailed, err.Error()
+		return item
+	}
+
+	item.Status = ImportCreated
+	return item
+}
+
+func importAnalysis(ctx context.Context, userID int, name string, data []byte) ImportItem {
+	item := ImportItem{Name: name}
+
+	var analysis Analysis
+	if err := json.Unmarshal(data, &analysis); err != nil {
+		item.Status = ImportFailed
+		item.Reason = "invalid analysis JSON"
+		return item
+	}
+	item.SourceID = analysis.ID
+
+	if err := ValidateAnalysis(analysis); err != nil {
+		item.Status = ImportFailed
+		item.Reason = err.Error()
+		return item
+	}
+
+	detailsJSON, err := json.Marshal(analysis.Details)
+	if err != nil {
+		item.Status = ImportFailed
+		item.Reason = "invalid analysis details"
+		return item
+	}
+
+	var existingID int
+	err = database.DB.QueryRowContext(ctx,
+		`SELECT id FROM analyses
+		WHERE user_id = $1 AND title = $2 AND details = $3::jsonb AND deleted_at IS NULL
+		LIMIT 1`,
+		userID, analysis.Title, detailsJSON,
+	).Scan(&existingID)
+	if err == nil {
+		item.Status = ImportSkipped
+		item.ID = existingID
+		item.Reason = "an identical analysis already exists"
+		return item
+	}
+	if err != sql.ErrNoRows {
+		slog.Error("Failed to check for existing analysis", "name", name, "error", err)
+		item.Status = ImportFailed
+		item.Reason = "failed to check for an existing analysis"
+		return item
+	}
+
+	// IDs are local to the exporting instance, so passages are derived again
+	// and provenance is dropped.
+	analysis.ID = 0
+	analysis.UserID = userID
+	analysis.Passages = nil
+	analysis.ParentID = nil
+	analysis.TemplateID = nil
+	id, err := InsertAnalysis(ctx, analysis)
+	if err != nil {
+		slog.Error("Failed to import analysis", "name", name, "error", err)
+		item.Status = ImportFailed
+		item.Reason = "failed to save analysis"
+		return item
+	}
+
+	item.Status = ImportCreated
+	item.ID = id
+	return item
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+)
+
+// UserRole is a user's role across the whole app.
+type UserRole string
+
+const (
+	UserRoleUser    UserRole = "user"
+	UserRoleTeacher UserRole = "teacher"
+	UserRoleAdmin   UserRole = "admin"
+)
+
+const (
+	AuditRoleChanged        = "role_changed"
+	AuditAccountDisabled    = "account_disabled"
+	AuditAccountEnabled     = "account_enabled"
+	AuditAnalysisReassigned = "analysis_reassigned"
+)
+
+var userRoleRanks = map[UserRole]int{
+	UserRoleUser:    1,
+	UserRoleTeacher: 2,
+	UserRoleAdmin:   3,
+}
+
+func (r UserRole) Valid() bool {
+	return userRoleRanks[r] > 0
+}
+
+// AtLeast reports whether r grants everything other does.
+func (r UserRole) AtLeast(other UserRole) bool {
+	return userRoleRanks[r] >= userRoleRanks[other]
+}
+
+// IsAdmin reports whether the user is an admin.
+func (u User) IsAdmin() bool {
+	return u.Role.AtLeast(UserRoleAdmin)
+}
+
+// UserUsage summarises what a user has stored and when they were last active.
+type UserUsage struct {
+	Analyses        int        `json:"analyses"`
+	TrashedAnalyses int        `json:"trashedAnalyses"`
+	DetailsBytes    int64      `json:"detailsBytes"`
+	Folders         int        `json:"folders"`
+	Templates       int        `json:"templates"`
+	AccessTokens    int        `json:"accessTokens"`
+	LastActiveAt    *time.Time `json:"lastActiveAt"`
+}
+
+// AdminUser is a user as the admin API lists them.
+type AdminUser struct {
+	User
+	DeleteAfter *time.Time `json:"deleteAfter,omitempty"`
+	Usage       UserUsage  `json:"usage"`
+}
+
+type UserPage struct {
+	Items    []AdminUser `json:"items"`
+	NextPage string      `json:"nextPage,omitempty"`
+}
+
+// ListUsers returns one page of users, optionally filtered by a substring of
+// their name or email. Page is the NextPage of the previous call.
+func ListUsers(ctx context.Context, q string, page string, limit int) (UserPage, error) {
+	defer metrics.ObserveQuery("ListUsers", time.Now())
+
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	afterID := 0
+	if page != "" {
+		var err error
+		afterID, err = strconv.Atoi(page)
+		if err != nil {
+			return UserPage{}, invalid("invalid page")
+		}
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT u.id, u.idp_id, coalesce(u.first_name, ''), coalesce(u.last_name, ''),
+		coalesce(u.nickname, ''), coalesce(u.name, ''), coalesce(u.picture, ''), coalesce(u.email, ''),
+		coalesce(u.email_verified, false), u.role, u.disabled_at, u.delete_after,
+		`+userUsageColumns+`
+		FROM users u
+		WHERE u.id > $1 AND ($2 = '' OR u.name ILIKE '%' || $2 || '%' OR u.email ILIKE '%' || $2 || '%')
+		ORDER BY u.id
+		LIMIT $3`,
+		afterID, q, limit+1,
+	)
+	if err != nil {
+		slog.Error("Failed to list users", "error", err)
+		return UserPage{}, err
+	}
+	defer rows.Close()
+
+	result := UserPage{Items: []AdminUser{}}
+	for rows.Next() {
+		var user AdminUser
+		err := rows.Scan(&user.ID, &user.IdpID, &user.FirstName, &user.LastName,
+			&user.Nickname, &user.Name, &user.Picture, &user.Email,
+			&user.EmailVerified, &user.Role, &user.DisabledAt, &user.DeleteAfter,
+			&user.Usage.Analyses, &user.Usage.TrashedAnalyses, &user.Usage.DetailsBytes,
+			&user.Usage.Folders, &user.Usage.Templates, &user.Usage.AccessTokens, &user.Usage.LastActiveAt)
+		if err != nil {
+			slog.Error("Failed to scan user", "error", err)
+			return UserPage{}, err
+		}
+		result.Items = append(result.Items, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return UserPage{}, err
+	}
+
+	if len(result.Items) > limit {
+		result.Items = result.Items[:limit]
+		result.NextPage = strconv.Itoa(result.Items[limit-1].ID)
+	}
+
+	return result, nil
+}
+
+// userUsageColumns selects a user's UserUsage; the user is aliased u.
+const userUsageColumns = `
+	(SELECT COUNT(*) FROM analyses a WHERE a.user_id = u.id AND a.deleted_at IS NULL),
+	(SELECT COUNT(*) FROM analyses a WHERE a.user_id = u.id AND a.deleted_at IS NOT NULL),
+	(SELECT coalesce(SUM(octet_length(a.details::text)), 0) FROM analyses a WHERE a.user_id = u.id),
+	(SELECT COUNT(*) FROM folders f WHERE f.user_id = u.id),
+	(SELECT COUNT(*) FROM analysis_templates t WHERE t.user_id = u.id),
+	(SELECT COUNT(*) FROM personal_access_tokens p WHERE p.user_id = u.id),
+	(SELECT MAX(a.updated_at) FROM analyses a WHERE a.user_id = u.id)`
+
+// GetUserUsage returns what a user has stored.
+func GetUserUsage(ctx context.Context, userID int) (UserUsage, error) {
+	defer metrics.ObserveQuery("GetUserUsage", time.Now())
+
+	var usage UserUsage
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT `+userUsageColumns+` FROM users u WHERE u.id = $1`,
+		userID,
+	).Scan(&usage.Analyses, &usage.TrashedAnalyses, &usage.DetailsBytes,
+		&usage.Folders, &usage.Templates, &usage.AccessTokens, &usage.LastActiveAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return usage, notFound("user not found")
+		}
+		slog.Error("Failed to get user usage", "error", err)
+		return usage, err
+	}
+
+	return usage, nil
+}
+
+// SetUserRole changes a user's role on behalf of adminID.
+func SetUserRole(ctx context.Context, userID int, role UserRole, adminID int) error {
+	if !role.Valid() {
+		return invalid("unknown role %q", role)
+	}
+	if userID == adminID && role != UserRoleAdmin {
+		return invalid("admins cannot remove their own admin role")
+	}
+
+	return updateUserAsAdmin(ctx, userID, adminID, AuditRoleChanged,
+		map[string]interface{}{"role": role},
+		`UPDATE users SET role = $2 WHERE id = $1 RETURNING idp_id`, role)
+}
+
+// SetUserDisabled disables or re-enables a user's account on behalf of
+// adminID. Disabled users cannot sign in or use the API, but keep their data.
+func SetUserDisabled(ctx context.Context, userID int, disabled bool, adminID int) error {
+	if disabled && userID == adminID {
+		return invalid("admins cannot disable their own account")
+	}
+
+	if disabled {
+		return updateUserAsAdmin(ctx, userID, adminID, AuditAccountDisabled, nil,
+			`UPDATE users SET disabled_at = coalesce(disabled_at, NOW()) WHERE id = $1 RETURNING idp_id`)
+	}
+
+	return updateUserAsAdmin(ctx, userID, adminID, AuditAccountEnabled, nil,
+		`UPDATE users SET disabled_at = NULL WHERE id = $1 RETURNING idp_id`)
+}
+
+// updateUserAsAdmin runs query, which updates the user $1 and returns their
+// IdP ID, and audits it in the same transaction.
+func updateUserAsAdmin(ctx context.Context, userID int, adminID int, action string, details map[string]interface{}, query string, args ...interface{}) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var idpID string
+	err = tx.QueryRowContext(ctx, query, append([]interface{}{userID}, args...)...).Scan(&idpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("user not found")
+		}
+		slog.Error("Failed to update user", "userID", userID, "action", action, "error", err)
+		return err
+	}
+
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["adminId"] = adminID
+	if err := writeAudit(ctx, tx, userID, idpID, action, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	users.invalidate(idpID)
+
+	return nil
+}
+
+// ReassignAnalysis makes another user the owner of an analysis on behalf of
+// adminID. The new owner stops being a member, since owning implies it, and
+// the analysis leaves the old owner's folder.
+func ReassignAnalysis(ctx context.Context, analysisID int, newOwnerID int, adminID int) error {
+	defer metrics.ObserveQuery("ReassignAnalysis", time.Now())
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldOwnerID int
+	err = tx.QueryRowContext(ctx,
+		`SELECT user_id FROM analyses WHERE id = $1 FOR UPDATE`,
+		analysisID,
+	).Scan(&oldOwnerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("analysis not found")
+		}
+		return fmt.Errorf("error locking analysis: %w", err)
+	}
+
+	var idpID string
+	err = tx.QueryRowContext(ctx, `SELECT idp_id FROM users WHERE id = $1`, newOwnerID).Scan(&idpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("user not found")
+		}
+		return fmt.Errorf("error getting new owner: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE analyses SET user_id = $2 WHERE id = $1`,
+		analysisID, newOwnerID,
+	)
+	if err != nil {
+		return fmt.Errorf("error reassigning analysis: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM user_analysis_folders WHERE analysis_id = $1 AND user_id = $2`,
+		analysisID, oldOwnerID,
+	)
+	if err != nil {
+		return fmt.Errorf("error unfiling analysis for the previous owner: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM analysis_members WHERE analysis_id = $1 AND user_id = $2`,
+		analysisID, newOwnerID,
+	)
+	if err != nil {
+		return fmt.Errorf("error removing new owner's membership: %w", err)
+	}
+
+	details := map[string]interface{}{"analysisId": analysisID, "fromUserId": oldOwnerID, "adminId": adminID}
+	if err := writeAudit(ctx, tx, newOwnerID, idpID, AuditAnalysisReassigned, details); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
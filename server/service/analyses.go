@@ -1,15 +1,24 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
 	"github.com/lib/pq"
 )
 
+// The layout the editor uses for an analysis that never saved one: the line
+// height of the Greek and the Greek column's share of the page in percent.
+const (
+	DefaultLineSpacing   = 3
+	DefaultSplitPosition = 50
+)
+
 type Analysis struct {
 	ID          int                    `json:"id"`
 	UserID      int                    `json:"user_id"`
@@ -18,9 +27,20 @@ type Analysis struct {
 	Details     map[string]interface{} `json:"details,omitempty"` // json object
 	CreatedAt   string                 `json:"created_at"`
 	UpdatedAt   string                 `json:"updated_at"`
+	Role        AnalysisRole           `json:"role,omitempty"`
+	FolderID    *int                   `json:"folderId,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Passages    []PassageRange         `json:"passages,omitempty"`
+	ParentID    *int                   `json:"parentId,omitempty"`
+	TemplateID  *int                   `json:"templateId,omitempty"`
+	DeletedAt   *string                `json:"deletedAt,omitempty"`
 }
 
-func InsertAnalysis(analysis Analysis) (int, error) {
+// InsertAnalysis saves a new analysis with the passages it covers. When the
+// caller does not say which verses those are, they are derived from the details.
+func InsertAnalysis(ctx context.Context, analysis Analysis) (int, error) {
+	defer metrics.ObserveQuery("InsertAnalysis", time.Now())
+
 	var id int
 	detailsJSON, err := json.Marshal(analysis.Details)
 	if err != nil {
@@ -28,10 +48,28 @@ func InsertAnalysis(analysis Analysis) (int, error) {
 		return 0, err
 	}
 
-	err = database.DB.QueryRow(
-		`INSERT INTO analyses (user_id, details, title, description) 
-		VALUES ($1, $2, $3, $4) RETURNING id`,
-		analysis.UserID, detailsJSON, analysis.Title, analysis.Description,
+	passages := analysis.Passages
+	if passages == nil {
+		passages, err = derivePassages(ctx, analysis.Title, analysis.Details)
+		if err != nil {
+			slog.Error("Failed to derive analysis passages", "error", err)
+			return 0, err
+		}
+	}
+	if err := validatePassages(passages); err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO analyses (user_id, details, title, description, parent_id, template_id) 
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		analysis.UserID, detailsJSON, analysis.Title, analysis.Description, analysis.ParentID, analysis.TemplateID,
 	).Scan(&id)
 
 	if err != nil {
@@ -42,23 +80,53 @@ func InsertAnalysis(analysis Analysis) (int, error) {
 		return 0, err
 	}
 
+	if err := setPassages(ctx, tx, id, passages); err != nil {
+		slog.Error("Failed to insert analysis passages", "error", err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	metrics.AnalysisCreated()
+
 	return id, nil
 }
 
-func UpdateAnalysis(analysis Analysis) error {
+// UpdateAnalysis saves changes to an analysis. Passages the caller leaves out
+// keep what is stored, so an autosave neither derives them again nor replaces
+// a range chosen when the analysis was created.
+func UpdateAnalysis(ctx context.Context, analysis Analysis) error {
+	defer metrics.ObserveQuery("UpdateAnalysis", time.Now())
+
 	detailsJSON, err := json.Marshal(analysis.Details)
 	if err != nil {
 		slog.Error("Failed to marshal analysis details", "error", err)
 		return err
 	}
 
-	result, err := database.DB.Exec(
+	if analysis.Passages != nil {
+		if err := validatePassages(analysis.Passages); err != nil {
+			return err
+		}
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
 		`UPDATE analyses 
 		SET details = $1, 
 		updated_at = NOW(),
 		title = $2,
 		description = $3
-		WHERE id = $4 AND user_id = $5`,
+		WHERE id = $4 AND deleted_at IS NULL AND (user_id = $5 OR EXISTS (
+			SELECT 1 FROM analysis_members m
+			WHERE m.analysis_id = analyses.id AND m.user_id = $5 AND m.role = 'editor'
+		))`,
 		detailsJSON, analysis.Title, analysis.Description, analysis.ID, analysis.UserID,
 	)
 
@@ -73,20 +141,39 @@ func UpdateAnalysis(analysis Analysis) error {
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("no analysis found with the given id for this user")
+		return deniedOrNotFound(ctx, analysis.ID, analysis.UserID, false,
+			"viewers cannot edit this analysis",
+			"no analysis found with the given id for this user")
+	}
+
+	if analysis.Passages != nil {
+		if err := setPassages(ctx, tx, analysis.ID, analysis.Passages); err != nil {
+			slog.Error("Failed to update analysis passages", "error", err)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
 	}
+	metrics.AnalysisUpdated(len(detailsJSON))
 
 	return nil
 }
 
-func GetAnalysisById(id int, userId int) (Analysis, error) {
+func GetAnalysisById(ctx context.Context, id int, userId int) (Analysis, error) {
+	defer metrics.ObserveQuery("GetAnalysisById", time.Now())
+
 	var analysis Analysis
 	var detailsJSON []byte
 
-	err := database.DB.QueryRow(
-		`SELECT id, user_id, details, created_at, updated_at, title, description
-		FROM analyses
-		WHERE id = $1 AND user_id = $2`,
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT a.id, a.user_id, a.details, a.created_at, a.updated_at, a.title, a.description,
+		CASE WHEN a.user_id = $2 THEN 'owner' ELSE m.role END,
+		a.parent_id, a.template_id
+		FROM analyses a
+		LEFT JOIN analysis_members m ON m.analysis_id = a.id AND m.user_id = $2
+		WHERE a.id = $1 AND a.deleted_at IS NULL AND (a.user_id = $2 OR m.user_id IS NOT NULL)`,
 		id, userId,
 	).
 		Scan(&analysis.ID,
@@ -95,11 +182,14 @@ func GetAnalysisById(id int, userId int) (Analysis, error) {
 			&analysis.CreatedAt,
 			&analysis.UpdatedAt,
 			&analysis.Title,
-			&analysis.Description)
+			&analysis.Description,
+			&analysis.Role,
+			&analysis.ParentID,
+			&analysis.TemplateID)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return analysis, errors.New("analysis not found")
+			return analysis, notFound("analysis not found")
 		}
 		slog.Error("Failed to get analysis", "error", err)
 		return analysis, err
@@ -111,18 +201,28 @@ func GetAnalysisById(id int, userId int) (Analysis, error) {
 		return analysis, err
 	}
 
+	passages, err := getPassages(ctx, []int{analysis.ID})
+	if err != nil {
+		return analysis, err
+	}
+	analysis.Passages = passages[analysis.ID]
+
 	return analysis, nil
 }
 
-func GetAnalysesForUser(userId int) ([]Analysis, error) {
+func GetAnalysesForUser(ctx context.Context, userId int) ([]Analysis, error) {
+	defer metrics.ObserveQuery("GetAnalysesForUser", time.Now())
+
 	var analyses []Analysis
 
-	// Include created_at and last_modified timestamps
-	rows, err := database.DB.Query(
-		`select id, user_id, created_at, updated_at, title, description
-		from analyses 
-		where user_id = $1
-		order by updated_at desc`,
+	// Include created_at and last_modified timestamps, and the analyses shared with the user
+	rows, err := database.DB.QueryContext(ctx,
+		`select a.id, a.user_id, a.created_at, a.updated_at, a.title, a.description,
+		case when a.user_id = $1 then 'owner' else m.role end
+		from analyses a
+		left join analysis_members m on m.analysis_id = a.id and m.user_id = $1
+		where (a.user_id = $1 or m.user_id is not null) and a.deleted_at is null
+		order by a.updated_at desc`,
 		userId,
 	)
 	if err != nil {
@@ -138,7 +238,8 @@ func GetAnalysesForUser(userId int) ([]Analysis, error) {
 			&analysis.CreatedAt,
 			&analysis.UpdatedAt,
 			&analysis.Title,
-			&analysis.Description)
+			&analysis.Description,
+			&analysis.Role)
 		if err != nil {
 			slog.Error("Failed to scan analysis", "error", err)
 			return nil, err
@@ -154,14 +255,16 @@ func GetAnalysesForUser(userId int) ([]Analysis, error) {
 	return analyses, nil
 }
 
-func GetLastUpdatedAnalysis(userId int) (Analysis, error) {
+func GetLastUpdatedAnalysis(ctx context.Context, userId int) (Analysis, error) {
+	defer metrics.ObserveQuery("GetLastUpdatedAnalysis", time.Now())
+
 	var analysis Analysis
 	var detailsJSON []byte
 
-	err := database.DB.QueryRow(
+	err := database.DB.QueryRowContext(ctx,
 		`select id, user_id, details, created_at, updated_at, title, description
 		from analyses
-		where user_id = $1
+		where user_id = $1 and deleted_at is null
 		order by updated_at desc
 		limit 1`,
 		userId,
@@ -176,11 +279,12 @@ func GetLastUpdatedAnalysis(userId int) (Analysis, error) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return analysis, errors.New("no analyses found for this user")
+			return analysis, notFound("no analyses found for this user")
 		}
 		slog.Error("failed to get most recent analysis", "error", err)
 		return analysis, err
 	}
+	analysis.Role = RoleOwner
 
 	analysis.Details = make(map[string]interface{})
 	if err := json.Unmarshal(detailsJSON, &analysis.Details); err != nil {
@@ -191,10 +295,58 @@ func GetLastUpdatedAnalysis(userId int) (Analysis, error) {
 	return analysis, nil
 }
 
-func DeleteAnalysis(id int, userId int) error {
-	result, err := database.DB.Exec(
-		`DELETE FROM analyses 
-		WHERE id = $1 AND user_id = $2`,
+// DuplicateAnalysis copies an analysis the user can open into a new analysis
+// owned by the user, recording the original as its parent. Tags, folder and
+// members stay with the original.
+func DuplicateAnalysis(ctx context.Context, analysisID int, userID int, title string) (Analysis, error) {
+	original, err := GetAnalysisById(ctx, analysisID, userID)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	if title == "" {
+		title = original.Title + " (copy)"
+		if runes := []rune(title); len(runes) > maxTitleLength {
+			title = string(runes[:maxTitleLength])
+		}
+	}
+
+	duplicate := Analysis{
+		UserID:      userID,
+		Title:       title,
+		Description: original.Description,
+		Details:     original.Details,
+		Passages:    []PassageRange{},
+		ParentID:    &original.ID,
+		TemplateID:  original.TemplateID,
+	}
+	for _, passage := range original.Passages {
+		duplicate.Passages = append(duplicate.Passages, PassageRange{
+			StartVerseID: passage.StartVerseID,
+			EndVerseID:   passage.EndVerseID,
+		})
+	}
+
+	if err := ValidateAnalysis(duplicate); err != nil {
+		return Analysis{}, err
+	}
+
+	id, err := InsertAnalysis(ctx, duplicate)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	return GetAnalysisById(ctx, id, userID)
+}
+
+// DeleteAnalysis moves an analysis to the trash. It can be restored until
+// the trash purger removes it.
+func DeleteAnalysis(ctx context.Context, id int, userId int) error {
+	defer metrics.ObserveQuery("DeleteAnalysis", time.Now())
+
+	result, err := database.DB.ExecContext(ctx,
+		`UPDATE analyses SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND user_id = $2`,
 		id, userId,
 	)
 
@@ -210,7 +362,45 @@ func DeleteAnalysis(id int, userId int) error {
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("no analysis found with the given id for this user")
+		return deniedOrNotFound(ctx, id, userId, false,
+			"only owners can delete this analysis",
+			"no analysis found with the given id for this user")
+	}
+
+	return nil
+}
+
+// maxTitleLength matches the analyses.title column.
+const maxTitleLength = 100
+
+// ValidateAnalysis checks that an analysis document can be stored and opened by the editor.
+func ValidateAnalysis(analysis Analysis) error {
+	if len([]rune(analysis.Title)) > maxTitleLength {
+		return invalid("title must be at most %d characters", maxTitleLength)
+	}
+
+	if analysis.Details == nil {
+		return invalid("details are required")
+	}
+
+	sections, ok := analysis.Details["sections"]
+	if !ok {
+		return invalid("details must contain sections")
+	}
+
+	list, ok := sections.([]interface{})
+	if !ok {
+		return invalid("details.sections must be a list")
+	}
+
+	for i, section := range list {
+		fields, ok := section.(map[string]interface{})
+		if !ok {
+			return invalid("details.sections[%d] must be an object", i)
+		}
+		if _, ok := fields["words"].([]interface{}); !ok {
+			return invalid("details.sections[%d].words must be a list", i)
+		}
 	}
 
 	return nil
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
 )
 
 type Book struct {
@@ -38,8 +41,10 @@ type Word struct {
 	Definition string `json:"definition"`
 }
 
-func GetBooks() ([]Book, error) {
-	rows, err := database.DB.Query("SELECT id, title FROM books")
+func GetBooks(ctx context.Context) ([]Book, error) {
+	defer metrics.ObserveQuery("GetBooks", time.Now())
+
+	rows, err := database.DB.QueryContext(ctx, "SELECT id, title FROM books")
 	if err != nil {
 		return nil, fmt.Errorf("error querying books: %w", err)
 	}
@@ -61,8 +66,10 @@ func GetBooks() ([]Book, error) {
 	return books, nil
 }
 
-func GetChapters(bookID int) ([]Chapter, error) {
-	rows, err := database.DB.Query("SELECT id, book_id, number FROM chapters WHERE book_id = $1", bookID)
+func GetChapters(ctx context.Context, bookID int) ([]Chapter, error) {
+	defer metrics.ObserveQuery("GetChapters", time.Now())
+
+	rows, err := database.DB.QueryContext(ctx, "SELECT id, book_id, number FROM chapters WHERE book_id = $1", bookID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying chapters: %w", err)
 	}
@@ -84,8 +91,10 @@ func GetChapters(bookID int) ([]Chapter, error) {
 	return chapters, nil
 }
 
-func GetVerses(chapterID int) ([]Verse, error) {
-	rows, err := database.DB.Query("SELECT id, chapter_id, number FROM verses WHERE chapter_id = $1", chapterID)
+func GetVerses(ctx context.Context, chapterID int) ([]Verse, error) {
+	defer metrics.ObserveQuery("GetVerses", time.Now())
+
+	rows, err := database.DB.QueryContext(ctx, "SELECT id, chapter_id, number FROM verses WHERE chapter_id = $1", chapterID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying verses: %w", err)
 	}
@@ -107,15 +116,22 @@ func GetVerses(chapterID int) ([]Verse, error) {
 	return verses, nil
 }
 
-func GetVersesWithWords(startID, endID int) ([]Verse, error) {
+func GetVersesWithWords(ctx context.Context, startID, endID int) ([]Verse, error) {
+	defer metrics.ObserveQuery("GetVersesWithWords", time.Now())
+
+	if startID > endID {
+		return nil, invalid("startId must not be after endId")
+	}
+
+	// json_agg is NULL over no rows, so both levels fall back to an empty list.
 	query := `
-        SELECT json_agg(
+        SELECT COALESCE(json_agg(
             json_build_object(
                 'id', v.id,
                 'chapterId', v.chapter_id,
                 'number', v.number,
                 'words', (
-                    SELECT json_agg(
+                    SELECT COALESCE(json_agg(
                         json_build_object(
                             'id', w.id,
                             'verseId', w.verse_id,
@@ -125,18 +141,18 @@ func GetVersesWithWords(startID, endID int) ([]Verse, error) {
                             'morph', w.morph,
                             'definition', COALESCE(s.definitions->0->>'definition', '')
                         )
-                    )
+                    ), '[]')
                     FROM words w
                     JOIN strongs s on w.strong = s.code
                     WHERE w.verse_id = v.id
                 )
             )
-        ) AS verses
+        ), '[]') AS verses
         FROM verses v
         WHERE v.id BETWEEN $1 AND $2`
 
 	// Execute the query
-	row := database.DB.QueryRow(query, startID, endID)
+	row := database.DB.QueryRowContext(ctx, query, startID, endID)
 
 	// The result will be a JSON array, so we need to store it as a raw JSON string first
 	var jsonResult []byte
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+)
+
+const (
+	AuditAccountDeletionScheduled = "account_deletion_scheduled"
+	AuditAccountDeletionCancelled = "account_deletion_cancelled"
+	AuditAccountPurged            = "account_purged"
+)
+
+// AccountDeletion describes a pending or completed account deletion.
+type AccountDeletion struct {
+	UserID      int        `json:"userId"`
+	Purged      bool       `json:"purged"`
+	DeleteAfter *time.Time `json:"deleteAfter,omitempty"`
+}
+
+// DeleteAccount purges the user immediately when grace is zero. Otherwise it
+// schedules the purge for after the grace period, which the user can cancel
+// until then.
+func DeleteAccount(ctx context.Context, userID int, grace time.Duration, source string) (AccountDeletion, error) {
+	defer metrics.ObserveQuery("DeleteAccount", time.Now())
+
+	if grace <= 0 {
+		if err := PurgeUser(ctx, userID, source); err != nil {
+			return AccountDeletion{}, err
+		}
+		return AccountDeletion{UserID: userID, Purged: true}, nil
+	}
+
+	deleteAfter := time.Now().Add(grace).UTC()
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return AccountDeletion{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var idpID string
+	err = tx.QueryRowContext(ctx,
+		`UPDATE users SET delete_after = $1 WHERE id = $2 RETURNING idp_id`,
+		deleteAfter, userID,
+	).Scan(&idpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AccountDeletion{}, notFound("user not found")
+		}
+		slog.Error("Failed to schedule account deletion", "userID", userID, "error", err)
+		return AccountDeletion{}, err
+	}
+
+	details := map[string]interface{}{"deleteAfter": deleteAfter, "source": source}
+	if err := writeAudit(ctx, tx, userID, idpID, AuditAccountDeletionScheduled, details); err != nil {
+		return AccountDeletion{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return AccountDeletion{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return AccountDeletion{UserID: userID, DeleteAfter: &deleteAfter}, nil
+}
+
+// CancelAccountDeletion clears a scheduled deletion.
+func CancelAccountDeletion(ctx context.Context, userID int) error {
+	defer metrics.ObserveQuery("CancelAccountDeletion", time.Now())
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var idpID string
+	err = tx.QueryRowContext(ctx,
+		`UPDATE users SET delete_after = NULL
+		WHERE id = $1 AND delete_after IS NOT NULL
+		RETURNING idp_id`,
+		userID,
+	).Scan(&idpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("no account deletion is scheduled")
+		}
+		slog.Error("Failed to cancel account deletion", "userID", userID, "error", err)
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, userID, idpID, AuditAccountDeletionCancelled, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeUser hard-deletes a user and everything they own in one transaction:
+// their analyses (and with them the shares and memberships of those analyses),
+// their memberships in other users' analyses, and the user row itself. An
+// audit record of the purge is written in the same transaction.
+func PurgeUser(ctx context.Context, userID int, source string) error {
+	defer metrics.ObserveQuery("PurgeUser", time.Now())
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var idpID string
+	err = tx.QueryRowContext(ctx, `SELECT idp_id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&idpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("user not found")
+		}
+		return fmt.Errorf("error locking user: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM analyses WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting analyses: %w", err)
+	}
+	analysesDeleted, _ := result.RowsAffected()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM analysis_members WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error deleting analysis memberships: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	details := map[string]interface{}{"analyses": analysesDeleted, "source": source}
+	if err := writeAudit(ctx, tx, userID, idpID, AuditAccountPurged, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	users.invalidate(idpID)
+
+	slog.Info("Purged user", "userID", userID, "analyses", analysesDeleted, "source", source)
+	return nil
+}
+
+// PurgeUserByIdpID purges the user with the given IdP subject.
+func PurgeUserByIdpID(ctx context.Context, idpID string, source string) error {
+	user, err := GetUserByIdpID(ctx, idpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFound("user not found")
+		}
+		return err
+	}
+
+	return PurgeUser(ctx, user.ID, source)
+}
+
+// PurgeDueAccounts purges every account whose grace period has ended and
+// returns how many were purged.
+func PurgeDueAccounts(ctx context.Context) (int, error) {
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id FROM users WHERE delete_after IS NOT NULL AND delete_after <= NOW()`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error querying accounts due for deletion: %w", err)
+	}
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning user id: %w", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating over accounts due for deletion: %w", err)
+	}
+
+	purged := 0
+	for _, id := range userIDs {
+		if err := PurgeUser(ctx, id, "scheduled"); err != nil {
+			slog.Error("Failed to purge scheduled account", "userID", id, "error", err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// RunAccountPurger purges due accounts every interval until ctx is cancelled.
+func RunAccountPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := PurgeDueAccounts(ctx); err != nil {
+			slog.Error("Failed to purge scheduled accounts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeAudit(ctx context.Context, tx *sql.Tx, userID int, idpID string, action string, details map[string]interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("error marshalling audit details: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO audit_log (user_id, idp_id, action, details) VALUES ($1, $2, $3, $4)`,
+		userID, idpID, action, detailsJSON,
+	)
+	if err != nil {
+		return fmt.Errorf("error writing audit record: %w", err)
+	}
+
+	return nil
+}
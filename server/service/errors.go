@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of error callers can act on. Test for them with errors.Is; the
+// messages of errors of these kinds are meant for users. Any other error is a
+// failure of the server.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrInvalid   = errors.New("invalid")
+	ErrConflict  = errors.New("conflict")
+)
+
+// kindError is an error of one of the kinds above.
+type kindError struct {
+	kind    error
+	message string
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &kindError{kind: ErrNotFound, message: fmt.Sprintf(format, args...)}
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return &kindError{kind: ErrForbidden, message: fmt.Sprintf(format, args...)}
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &kindError{kind: ErrInvalid, message: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...interface{}) error {
+	return &kindError{kind: ErrConflict, message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+	"github.com/lib/pq"
+)
+
+const (
+	maxFolderNameLength = 100
+	maxTagLength        = 50
+	maxTagsPerAnalysis  = 20
+)
+
+type Folder struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"userId"`
+	Name      string `json:"name"`
+	Analyses  int    `json:"analyses"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type TagCount struct {
+	Tag      string `json:"tag"`
+	Analyses int    `json:"analyses"`
+}
+
+func GetFolders(ctx context.Context, userID int) ([]Folder, error) {
+	defer metrics.ObserveQuery("GetFolders", time.Now())
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT f.id, f.user_id, f.name, f.created_at,
+		(SELECT count(*) FROM user_analysis_folders uf
+			JOIN analyses a ON a.id = uf.analysis_id
+			WHERE uf.folder_id = f.id AND a.deleted_at IS NULL)
+		FROM folders f
+		WHERE f.user_id = $1
+		ORDER BY lower(f.name)`,
+		userID,
+	)
+	if err != nil {
+		slog.Error("Failed to get folders", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []Folder{}
+	for rows.Next() {
+		var folder Folder
+		if err := rows.Scan(&folder.ID, &folder.UserID, &folder.Name, &folder.CreatedAt, &folder.Analyses); err != nil {
+			slog.Error("Failed to scan folder", "error", err)
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+func InsertFolder(ctx context.Context, userID int, name string) (Folder, error) {
+	defer metrics.ObserveQuery("InsertFolder", time.Now())
+
+	folder := Folder{UserID: userID}
+
+	name, err := cleanFolderName(name)
+	if err != nil {
+		return folder, err
+	}
+
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO folders (user_id, name) VALUES ($1, $2)
+		RETURNING id, name, created_at`,
+		userID, name,
+	).Scan(&folder.ID, &folder.Name, &folder.CreatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return folder, conflict("a folder with this name already exists")
+		}
+		slog.Error("Failed to insert folder", "error", err)
+		return folder, err
+	}
+
+	return folder, nil
+}
+
+func RenameFolder(ctx context.Context, folderID int, userID int, name string) error {
+	defer metrics.ObserveQuery("RenameFolder", time.Now())
+
+	name, err := cleanFolderName(name)
+	if err != nil {
+		return err
+	}
+
+	result, err := database.DB.ExecContext(ctx,
+		`UPDATE folders SET name = $1 WHERE id = $2 AND user_id = $3`,
+		name, folderID, userID,
+	)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return conflict("a folder with this name already exists")
+		}
+		slog.Error("Failed to rename folder", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result, "no folder found with the given id for this user")
+}
+
+// DeleteFolder deletes a folder. Its analyses are kept and become unfiled.
+func DeleteFolder(ctx context.Context, folderID int, userID int) error {
+	defer metrics.ObserveQuery("DeleteFolder", time.Now())
+
+	result, err := database.DB.ExecContext(ctx,
+		`DELETE FROM folders WHERE id = $1 AND user_id = $2`,
+		folderID, userID,
+	)
+	if err != nil {
+		slog.Error("Failed to delete folder", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result, "no folder found with the given id for this user")
+}
+
+// SetAnalysisFolder files an analysis the user can open into one of their
+// folders, or unfiles it when folderID is nil. Folders are per user, so
+// filing an analysis does not move it for its owner or other members.
+func SetAnalysisFolder(ctx context.Context, analysisID int, userID int, folderID *int) error {
+	defer metrics.ObserveQuery("SetAnalysisFolder", time.Now())
+
+	if _, err := GetAnalysisRole(ctx, analysisID, userID); err != nil {
+		return err
+	}
+
+	if folderID == nil {
+		_, err := database.DB.ExecContext(ctx,
+			`DELETE FROM user_analysis_folders WHERE user_id = $1 AND analysis_id = $2`,
+			userID, analysisID,
+		)
+		if err != nil {
+			slog.Error("Failed to unfile analysis", "error", err)
+			return err
+		}
+
+		return nil
+	}
+
+	var exists bool
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM folders WHERE id = $1 AND user_id = $2)`,
+		*folderID, userID,
+	).Scan(&exists)
+	if err != nil {
+		slog.Error("Failed to check folder", "error", err)
+		return err
+	}
+	if !exists {
+		return notFound("folder not found")
+	}
+
+	_, err = database.DB.ExecContext(ctx,
+		`INSERT INTO user_analysis_folders (user_id, analysis_id, folder_id) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, analysis_id) DO UPDATE SET folder_id = EXCLUDED.folder_id`,
+		userID, analysisID, *folderID,
+	)
+	if err != nil {
+		slog.Error("Failed to set analysis folder", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetAnalysisTags replaces the tags of an analysis the user can edit.
+// Tags are trimmed, lowercased and de-duplicated.
+func SetAnalysisTags(ctx context.Context, analysisID int, userID int, tags []string) ([]string, error) {
+	defer metrics.ObserveQuery("SetAnalysisTags", time.Now())
+
+	role, err := GetAnalysisRole(ctx, analysisID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !role.CanEdit() {
+		return nil, forbidden("you do not have permission to edit this analysis")
+	}
+
+	cleaned, err := cleanTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM analysis_tags WHERE analysis_id = $1`, analysisID); err != nil {
+		slog.Error("Failed to clear analysis tags", "error", err)
+		return nil, err
+	}
+
+	if len(cleaned) > 0 {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO analysis_tags (analysis_id, tag) SELECT $1, unnest($2::text[])`,
+			analysisID, pq.Array(cleaned),
+		)
+		if err != nil {
+			slog.Error("Failed to insert analysis tags", "error", err)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return cleaned, nil
+}
+
+// GetTags lists the tags used on analyses the user can open, most used first.
+func GetTags(ctx context.Context, userID int) ([]TagCount, error) {
+	defer metrics.ObserveQuery("GetTags", time.Now())
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT t.tag, count(*)
+		FROM analysis_tags t
+		JOIN analyses a ON a.id = t.analysis_id
+		LEFT JOIN analysis_members m ON m.analysis_id = a.id AND m.user_id = $1
+		WHERE (a.user_id = $1 OR m.user_id IS NOT NULL) AND a.deleted_at IS NULL
+		GROUP BY t.tag
+		ORDER BY count(*) DESC, t.tag`,
+		userID,
+	)
+	if err != nil {
+		slog.Error("Failed to get tags", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Analyses); err != nil {
+			slog.Error("Failed to scan tag", "error", err)
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func cleanFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", invalid("folder name is required")
+	}
+	if len([]rune(name)) > maxFolderNameLength {
+		return "", invalid("folder name is too long")
+	}
+
+	return name, nil
+}
+
+func cleanTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	cleaned := []string{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return nil, invalid("tags must be at most 50 characters")
+		}
+		seen[tag] = true
+		cleaned = append(cleaned, tag)
+	}
+
+	if len(cleaned) > maxTagsPerAnalysis {
+		return nil, invalid("an analysis can have at most 20 tags")
+	}
+
+	return cleaned, nil
+}
+
+// requireRowsAffected returns a not found error with the given message when
+// the statement affected no rows.
+func requireRowsAffected(result sql.Result, message string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return notFound("%s", message)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+)
+
+const (
+	maxPassageVerses     = 200
+	maxDescriptionLength = 100
+)
+
+// referencePattern matches "John 3", "John 3:16", "John 3:16-18", "John 3-4"
+// and "John 1:50-2:3". The book is everything before the first chapter number.
+var referencePattern = regexp.MustCompile(`^(.+?)\s+(\d+)(?::(\d+))?(?:\s*-\s*(\d+)(?::(\d+))?)?$`)
+
+// PassageOptions describes the passage an analysis is created from, either as
+// a reference or as an inclusive range of verse IDs.
+type PassageOptions struct {
+	Reference    string `json:"reference"`
+	StartVerseID int    `json:"startVerseId"`
+	EndVerseID   int    `json:"endVerseId"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	// FillParsing pre-fills each word's parsing from the corpus morphology.
+	FillParsing bool `json:"fillParsing"`
+	// TemplateID applies a template's settings and phrase palette.
+	TemplateID *int `json:"templateId"`
+}
+
+// passageSection and passageWord mirror the editor's Section and Word. Like
+// text imported in the editor, a passage is one section in which each verse
+// starts with a "[N]" marker word, and the translation has one entry per verse.
+type passageSection struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Words       []passageWord `json:"words"`
+	Phrases     []interface{} `json:"phrases"`
+	Translation []string      `json:"translation"`
+}
+
+type passageWord struct {
+	ID                 int          `json:"id"`
+	Text               string       `json:"text"`
+	CorpusWordID       int          `json:"corpusWordId,omitempty"`
+	Parsing            *WordParsing `json:"parsing,omitempty"`
+	LexicalForm        string       `json:"lexicalForm"`
+	GlossaryDefinition string       `json:"glossaryDefinition"`
+	Strongs            string       `json:"strongs"`
+}
+
+// CreateAnalysisFromPassage builds a new analysis from the corpus and returns
+// it as saved.
+func CreateAnalysisFromPassage(ctx context.Context, userID int, options PassageOptions) (Analysis, error) {
+	startID, endID := options.StartVerseID, options.EndVerseID
+	if options.Reference != "" {
+		var err error
+		startID, endID, err = ResolveReference(ctx, options.Reference)
+		if err != nil {
+			return Analysis{}, err
+		}
+	}
+	if startID <= 0 || endID <= 0 {
+		return Analysis{}, invalid("a reference or startVerseId and endVerseId are required")
+	}
+	if startID > endID {
+		return Analysis{}, invalid("a passage must not end before it starts")
+	}
+	if endID-startID >= maxPassageVerses {
+		return Analysis{}, invalid("a passage can have at most %d verses", maxPassageVerses)
+	}
+
+	settings := TemplateSettings{
+		LineSpacing:   DefaultLineSpacing,
+		SplitPosition: DefaultSplitPosition,
+		PhraseTypes:   []PhraseType{},
+	}
+	if options.TemplateID != nil {
+		template, err := GetTemplate(ctx, *options.TemplateID, userID)
+		if err != nil {
+			return Analysis{}, err
+		}
+		settings = template.Settings
+	}
+
+	section, reference, err := buildPassageSection(ctx, startID, endID, options.FillParsing)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	analysis := Analysis{
+		UserID:      userID,
+		Title:       options.Title,
+		Description: options.Description,
+		Passages:    []PassageRange{{StartVerseID: startID, EndVerseID: endID}},
+		TemplateID:  options.TemplateID,
+	}
+	if analysis.Title == "" {
+		analysis.Title = reference
+	}
+	if analysis.Description == "" {
+		analysis.Description = passageDescription(section)
+	}
+
+	detailsJSON, err := json.Marshal(map[string]interface{}{
+		"sections":        []passageSection{section},
+		"lineSpacing":     settings.LineSpacing,
+		"showTranslation": settings.ShowTranslation,
+		"splitPosition":   settings.SplitPosition,
+		"phraseTypes":     settings.PhraseTypes,
+	})
+	if err != nil {
+		return Analysis{}, err
+	}
+	if err := json.Unmarshal(detailsJSON, &analysis.Details); err != nil {
+		return Analysis{}, err
+	}
+
+	if err := ValidateAnalysis(analysis); err != nil {
+		return Analysis{}, err
+	}
+
+	id, err := InsertAnalysis(ctx, analysis)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	return GetAnalysisById(ctx, id, userID)
+}
+
+// ResolveReference turns a reference such as "John 1:1-5" into the IDs of its
+// first and last verse. A chapter without verses means the whole chapter.
+func ResolveReference(ctx context.Context, reference string) (int, int, error) {
+	match := referencePattern.FindStringSubmatch(strings.TrimSpace(reference))
+	if match == nil {
+		return 0, 0, invalid("reference must look like \"John 1:1-5\"")
+	}
+
+	book := match[1]
+	startChapter, _ := strconv.Atoi(match[2])
+	startVerse, _ := strconv.Atoi(match[3])
+	endChapter, endVerse := startChapter, 0
+
+	switch {
+	case match[4] != "" && match[5] != "":
+		// "John 1:50-2:3"
+		endChapter, _ = strconv.Atoi(match[4])
+		endVerse, _ = strconv.Atoi(match[5])
+	case match[4] != "" && match[3] != "":
+		// "John 3:16-18"
+		endVerse, _ = strconv.Atoi(match[4])
+	case match[4] != "":
+		// "John 3-4"
+		endChapter, _ = strconv.Atoi(match[4])
+	default:
+		// "John 3" or "John 3:16"
+		endVerse = startVerse
+	}
+
+	startID, err := findVerseID(ctx, book, startChapter, startVerse, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	endID, err := findVerseID(ctx, book, endChapter, endVerse, true)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return startID, endID, nil
+}
+
+// findVerseID looks up a verse by book title, chapter and verse number. A
+// verse number of zero selects the first or, when last is set, the final verse
+// of the chapter.
+func findVerseID(ctx context.Context, book string, chapter int, verse int, last bool) (int, error) {
+	order := "ASC"
+	if last {
+		order = "DESC"
+	}
+
+	var id int
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT v.id FROM verses v
+		JOIN chapters c ON c.id = v.chapter_id
+		JOIN books b ON b.id = c.book_id
+		WHERE lower(b.title) = lower($1) AND c.number = $2 AND ($3 = 0 OR v.number = $3)
+		ORDER BY v.number `+order+`
+		LIMIT 1`,
+		book, chapter, verse,
+	).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			if verse == 0 {
+				return 0, invalid("%s %d not found", book, chapter)
+			}
+			return 0, invalid("%s %d:%d not found", book, chapter, verse)
+		}
+		slog.Error("Failed to find verse", "error", err)
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// buildPassageSection loads the verses between startID and endID with their
+// words and returns them as one section, along with the passage reference.
+func buildPassageSection(ctx context.Context, startID, endID int, fillParsing bool) (passageSection, string, error) {
+	section := passageSection{
+		ID:          startID,
+		Words:       []passageWord{},
+		Phrases:     []interface{}{},
+		Translation: []string{},
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT v.id, b.title, c.number, v.number,
+		w.id, w.text, coalesce(w.lemma, ''), coalesce(w.strong, ''), coalesce(w.morph, ''),
+		coalesce(s.definitions->0->>'definition', '')
+		FROM verses v
+		JOIN chapters c ON c.id = v.chapter_id
+		JOIN books b ON b.id = c.book_id
+		JOIN words w ON w.verse_id = v.id
+		LEFT JOIN strongs s ON s.code = w.strong
+		WHERE v.id BETWEEN $1 AND $2
+		ORDER BY v.id, w.id`,
+		startID, endID,
+	)
+	if err != nil {
+		slog.Error("Failed to load passage", "error", err)
+		return section, "", err
+	}
+	defer rows.Close()
+
+	var first, last verseReference
+	lastVerseID := 0
+	for rows.Next() {
+		var verseID int
+		var ref verseReference
+		var word passageWord
+		var morph string
+		err := rows.Scan(&verseID, &ref.book, &ref.chapter, &ref.verse,
+			&word.CorpusWordID, &word.Text, &word.LexicalForm, &word.Strongs, &morph,
+			&word.GlossaryDefinition)
+		if err != nil {
+			slog.Error("Failed to scan passage word", "error", err)
+			return section, "", err
+		}
+
+		if verseID != lastVerseID {
+			if lastVerseID == 0 {
+				first = ref
+			}
+			last, lastVerseID = ref, verseID
+			section.Words = append(section.Words, passageWord{
+				ID:   len(section.Words) + 1,
+				Text: fmt.Sprintf("[%d]", ref.verse),
+			})
+		}
+
+		word.ID = len(section.Words) + 1
+		if fillParsing {
+			if parsing, ok := ParseMorph(morph); ok {
+				word.Parsing = &parsing
+			}
+		}
+		section.Words = append(section.Words, word)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return section, "", err
+	}
+
+	if lastVerseID == 0 {
+		return section, "", invalid("passage has no words")
+	}
+
+	section.Name = formatReference(first, last)
+	return section, section.Name, nil
+}
+
+func passageDescription(section passageSection) string {
+	words := make([]string, 0, len(section.Words))
+	for _, word := range section.Words {
+		words = append(words, word.Text)
+	}
+
+	description := []rune(strings.Join(words, " "))
+	if len(description) > maxDescriptionLength {
+		description = description[:maxDescriptionLength]
+	}
+
+	return string(description)
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+)
+
+// AnalysisRole is a user's level of access to an analysis.
+// The user referenced by analyses.user_id is always the owner.
+type AnalysisRole string
+
+const (
+	RoleOwner  AnalysisRole = "owner"
+	RoleEditor AnalysisRole = "editor"
+	RoleViewer AnalysisRole = "viewer"
+)
+
+// Grantable reports whether members can be given the role. Only the user in
+// analyses.user_id owns an analysis, so owner is not one of them.
+func (r AnalysisRole) Grantable() bool {
+	return r == RoleEditor || r == RoleViewer
+}
+
+func (r AnalysisRole) CanEdit() bool {
+	return r == RoleOwner || r == RoleEditor
+}
+
+func (r AnalysisRole) CanManage() bool {
+	return r == RoleOwner
+}
+
+type AnalysisMember struct {
+	AnalysisID int          `json:"analysisId"`
+	UserID     int          `json:"userId"`
+	Name       string       `json:"name"`
+	Email      string       `json:"email"`
+	Role       AnalysisRole `json:"role"`
+	CreatedAt  string       `json:"createdAt"`
+}
+
+// GetAnalysisRole returns the user's role on an analysis, or an error if the user has no access.
+func GetAnalysisRole(ctx context.Context, analysisID int, userID int) (AnalysisRole, error) {
+	return analysisRole(ctx, analysisID, userID, false)
+}
+
+// analysisRole returns the user's role on an analysis that is in the trash if
+// deleted is set, or not in it otherwise.
+func analysisRole(ctx context.Context, analysisID int, userID int, deleted bool) (AnalysisRole, error) {
+	defer metrics.ObserveQuery("GetAnalysisRole", time.Now())
+
+	var role sql.NullString
+
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT CASE WHEN a.user_id = $2 THEN 'owner' ELSE m.role END
+		FROM analyses a
+		LEFT JOIN analysis_members m ON m.analysis_id = a.id AND m.user_id = $2
+		WHERE a.id = $1 AND (a.deleted_at IS NOT NULL) = $3`,
+		analysisID, userID, deleted,
+	).Scan(&role)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", notFound("analysis not found")
+		}
+		slog.Error("Failed to get analysis role", "error", err)
+		return "", err
+	}
+
+	if !role.Valid {
+		return "", notFound("analysis not found")
+	}
+
+	return AnalysisRole(role.String), nil
+}
+
+// GetAnalysisMembers lists the owner and members of an analysis the user can access.
+func GetAnalysisMembers(ctx context.Context, analysisID int, userID int) ([]AnalysisMember, error) {
+	defer metrics.ObserveQuery("GetAnalysisMembers", time.Now())
+
+	if _, err := GetAnalysisRole(ctx, analysisID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT a.id, u.id, COALESCE(u.name, ''), COALESCE(u.email, ''), 'owner', a.created_at
+		FROM analyses a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.id = $1
+		UNION ALL
+		SELECT m.analysis_id, u.id, COALESCE(u.name, ''), COALESCE(u.email, ''), m.role, m.created_at
+		FROM analysis_members m
+		JOIN users u ON u.id = m.user_id
+		JOIN analyses a ON a.id = m.analysis_id
+		WHERE m.analysis_id = $1 AND m.user_id <> a.user_id`,
+		analysisID,
+	)
+	if err != nil {
+		slog.Error("Failed to get analysis members", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []AnalysisMember{}
+	for rows.Next() {
+		var member AnalysisMember
+		err := rows.Scan(&member.AnalysisID,
+			&member.UserID,
+			&member.Name,
+			&member.Email,
+			&member.Role,
+			&member.CreatedAt)
+		if err != nil {
+			slog.Error("Failed to scan analysis member", "error", err)
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// InviteAnalysisMember adds the user registered with the given email to an analysis
+// as an editor or viewer. Only the owner can invite, and inviting an existing
+// member updates their role.
+func InviteAnalysisMember(ctx context.Context, analysisID int, userID int, email string, role AnalysisRole) (AnalysisMember, error) {
+	defer metrics.ObserveQuery("InviteAnalysisMember", time.Now())
+
+	var member AnalysisMember
+
+	if !role.Grantable() {
+		return member, invalid("role must be editor or viewer")
+	}
+
+	if err := requireAnalysisManager(ctx, analysisID, userID, "only owners can invite members to this analysis"); err != nil {
+		return member, err
+	}
+
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT id, COALESCE(name, ''), COALESCE(email, '')
+		FROM users
+		WHERE lower(email) = lower($1)
+		ORDER BY email_verified DESC NULLS LAST, id
+		LIMIT 1`,
+		email,
+	).Scan(&member.UserID, &member.Name, &member.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return member, notFound("no user found with the given email")
+		}
+		slog.Error("Failed to find user by email", "error", err)
+		return member, err
+	}
+
+	if member.UserID == userID {
+		return member, invalid("cannot invite yourself")
+	}
+
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO analysis_members (analysis_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (analysis_id, user_id) DO UPDATE SET role = $3
+		RETURNING analysis_id, role, created_at`,
+		analysisID, member.UserID, role,
+	).Scan(&member.AnalysisID, &member.Role, &member.CreatedAt)
+	if err != nil {
+		slog.Error("Failed to insert analysis member", "error", err)
+		return member, err
+	}
+
+	return member, nil
+}
+
+// UpdateAnalysisMemberRole changes a member's role to editor or viewer. Only the
+// owner can change roles.
+func UpdateAnalysisMemberRole(ctx context.Context, analysisID int, userID int, memberID int, role AnalysisRole) error {
+	defer metrics.ObserveQuery("UpdateAnalysisMemberRole", time.Now())
+
+	if !role.Grantable() {
+		return invalid("role must be editor or viewer")
+	}
+
+	if err := requireAnalysisManager(ctx, analysisID, userID, "only owners can change the roles of members of this analysis"); err != nil {
+		return err
+	}
+
+	result, err := database.DB.ExecContext(ctx,
+		`UPDATE analysis_members SET role = $1
+		WHERE analysis_id = $2 AND user_id = $3`,
+		role, analysisID, memberID,
+	)
+	if err != nil {
+		slog.Error("Failed to update analysis member", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return notFound("no member found with the given id for this analysis")
+	}
+
+	return nil
+}
+
+// RemoveAnalysisMember removes a member from an analysis. Owners can remove anyone,
+// and members can remove themselves.
+func RemoveAnalysisMember(ctx context.Context, analysisID int, userID int, memberID int) error {
+	defer metrics.ObserveQuery("RemoveAnalysisMember", time.Now())
+
+	if memberID != userID {
+		if err := requireAnalysisManager(ctx, analysisID, userID, "only owners can remove other members of this analysis"); err != nil {
+			return err
+		}
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM analysis_members
+		WHERE analysis_id = $1 AND user_id = $2`,
+		analysisID, memberID,
+	)
+	if err != nil {
+		slog.Error("Failed to delete analysis member", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return notFound("no member found with the given id for this analysis")
+	}
+
+	// The analysis leaves the former member's folders along with their access.
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM user_analysis_folders WHERE analysis_id = $1 AND user_id = $2`,
+		analysisID, memberID,
+	)
+	if err != nil {
+		slog.Error("Failed to unfile analysis for removed member", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deniedOrNotFound explains why a change to an analysis matched no rows. Users
+// with a role on the analysis get a forbidden error with the denied message;
+// anyone else is told it does not exist.
+func deniedOrNotFound(ctx context.Context, analysisID int, userID int, deleted bool, denied string, missing string) error {
+	_, err := analysisRole(ctx, analysisID, userID, deleted)
+	if errors.Is(err, ErrNotFound) {
+		return notFound("%s", missing)
+	}
+	if err != nil {
+		return err
+	}
+
+	return forbidden("%s", denied)
+}
+
+// requireAnalysisManager returns a forbidden error with the given message
+// unless the user owns the analysis.
+func requireAnalysisManager(ctx context.Context, analysisID int, userID int, denied string) error {
+	role, err := GetAnalysisRole(ctx, analysisID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !role.CanManage() {
+		return forbidden("%s", denied)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import "strings"
+
+// WordParsing is the parsing of a word as the editor stores it: lowercase
+// values, empty when a field does not apply.
+type WordParsing struct {
+	PartOfSpeech string `json:"partOfSpeech"`
+	Person       string `json:"person,omitempty"`
+	Number       string `json:"number,omitempty"`
+	Tense        string `json:"tense,omitempty"`
+	Voice        string `json:"voice,omitempty"`
+	Mood         string `json:"mood,omitempty"`
+	Case         string `json:"case,omitempty"`
+	Gender       string `json:"gender,omitempty"`
+	Degree       string `json:"degree,omitempty"`
+	Type         string `json:"type,omitempty"`
+}
+
+var indeclinableParts = map[string]string{
+	"ADV":  "adverb",
+	"CONJ": "conjunction",
+	"COND": "conjunction",
+	"PREP": "preposition",
+	"PRT":  "particle",
+}
+
+var pronounTypes = map[byte]string{
+	'P': "personal",
+	'R': "relative",
+	'C': "reciprocal",
+	'D': "demonstrative",
+	'K': "demonstrative",
+	'I': "interrogative",
+	'Q': "interrogative",
+	'X': "indefinite",
+	'F': "reflexive",
+	'S': "possessive",
+}
+
+var morphTenses = map[byte]string{
+	'P': "present",
+	'I': "imperfect",
+	'F': "future",
+	'A': "aorist",
+	'R': "perfect",
+	'L': "pluperfect",
+}
+
+// Deponent and middle-or-passive voices are folded into the three voices the
+// editor offers.
+var morphVoices = map[byte]string{
+	'A': "active",
+	'M': "middle",
+	'P': "passive",
+	'E': "middle",
+	'D': "middle",
+	'N': "middle",
+	'O': "passive",
+}
+
+var morphMoods = map[byte]string{
+	'I': "indicative",
+	'S': "subjunctive",
+	'O': "optative",
+	'M': "imperative",
+	'N': "infinitive",
+	'P': "participle",
+}
+
+var morphCases = map[byte]string{
+	'N': "nominative",
+	'G': "genitive",
+	'D': "dative",
+	'A': "accusative",
+	'V': "vocative",
+}
+
+var morphNumbers = map[byte]string{
+	'S': "singular",
+	'P': "plural",
+}
+
+var morphGenders = map[byte]string{
+	'M': "masculine",
+	'F': "feminine",
+	'N': "neuter",
+}
+
+var morphPersons = map[byte]string{
+	'1': "1st",
+	'2': "2nd",
+	'3': "3rd",
+}
+
+// ParseMorph reads a Robinson morphology code such as "V-PAI-3S", "N-GSF" or
+// "P-1NS". It reports false for codes it does not understand, such as Hebrew
+// or Aramaic loan words.
+func ParseMorph(code string) (WordParsing, bool) {
+	var parsing WordParsing
+
+	parts := strings.Split(strings.ToUpper(strings.TrimSpace(code)), "-")
+	if len(parts) == 0 || parts[0] == "" {
+		return parsing, false
+	}
+
+	if pos, ok := indeclinableParts[parts[0]]; ok {
+		parsing.PartOfSpeech = pos
+		return parsing, true
+	}
+
+	switch parts[0] {
+	case "V":
+		return parseVerbMorph(parts[1:])
+	case "N":
+		parsing.PartOfSpeech = "noun"
+	case "A":
+		parsing.PartOfSpeech = "adjective"
+	case "T":
+		parsing.PartOfSpeech = "article"
+	default:
+		if len(parts[0]) != 1 {
+			return parsing, false
+		}
+		pronounType, ok := pronounTypes[parts[0][0]]
+		if !ok {
+			return parsing, false
+		}
+		parsing.PartOfSpeech = "pronoun"
+		parsing.Type = pronounType
+	}
+
+	if len(parts) < 2 {
+		return parsing, true
+	}
+
+	inflection := parts[1]
+	// Personal, reflexive and possessive pronouns lead with the person; the
+	// possessive also gives the possessor's number, which the editor has no field for.
+	if parsing.PartOfSpeech == "pronoun" && len(inflection) > 0 {
+		if person, ok := morphPersons[inflection[0]]; ok {
+			parsing.Person = person
+			inflection = inflection[1:]
+			if parsing.Type == "possessive" && len(inflection) > 3 {
+				inflection = inflection[1:]
+			}
+		}
+	}
+
+	parsing.Case = lookupMorph(morphCases, inflection, 0)
+	parsing.Number = lookupMorph(morphNumbers, inflection, 1)
+	parsing.Gender = lookupMorph(morphGenders, inflection, 2)
+
+	if parsing.PartOfSpeech == "adjective" && len(parts) > 2 {
+		switch parts[2] {
+		case "C":
+			parsing.Degree = "comparative"
+		case "S":
+			parsing.Degree = "superlative"
+		}
+	}
+
+	return parsing, true
+}
+
+func parseVerbMorph(parts []string) (WordParsing, bool) {
+	parsing := WordParsing{PartOfSpeech: "verb"}
+	if len(parts) == 0 {
+		return parsing, true
+	}
+
+	// Second aorists and second perfects are marked with a leading "2".
+	tvm := strings.TrimLeft(parts[0], "0123456789")
+	parsing.Tense = lookupMorph(morphTenses, tvm, 0)
+	parsing.Voice = lookupMorph(morphVoices, tvm, 1)
+	parsing.Mood = lookupMorph(morphMoods, tvm, 2)
+
+	if len(parts) < 2 {
+		return parsing, true
+	}
+
+	inflection := parts[1]
+	if parsing.Mood == "participle" {
+		parsing.Case = lookupMorph(morphCases, inflection, 0)
+		parsing.Number = lookupMorph(morphNumbers, inflection, 1)
+		parsing.Gender = lookupMorph(morphGenders, inflection, 2)
+	} else {
+		parsing.Person = lookupMorph(morphPersons, inflection, 0)
+		parsing.Number = lookupMorph(morphNumbers, inflection, 1)
+	}
+
+	return parsing, true
+}
+
+func lookupMorph(values map[byte]string, code string, i int) string {
+	if i >= len(code) {
+		return ""
+	}
+	return values[code[i]]
+}
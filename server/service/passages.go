@@ -0,0 +1,401 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+	"github.com/lib/pq"
+)
+
+const maxPassagesPerAnalysis = 50
+
+// verseMarker matches the "[N]" verse numbers the editor puts in front of each verse.
+var verseMarker = regexp.MustCompile(`^\[(\d+)\]$`)
+
+// PassageRange is an inclusive range of verses covered by an analysis.
+// Reference is filled in when reading, e.g. "John 1:1-5".
+type PassageRange struct {
+	StartVerseID int    `json:"startVerseId"`
+	EndVerseID   int    `json:"endVerseId"`
+	Reference    string `json:"reference,omitempty"`
+}
+
+type passageExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// GetAnalysesForVerse lists the analyses the user can open whose passages
+// include the verse, most recently updated first.
+func GetAnalysesForVerse(ctx context.Context, verseID int, userID int) ([]Analysis, error) {
+	defer metrics.ObserveQuery("GetAnalysesForVerse", time.Now())
+
+	var exists bool
+	err := database.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM verses WHERE id = $1)`, verseID).Scan(&exists)
+	if err != nil {
+		slog.Error("Failed to check verse", "error", err)
+		return nil, err
+	}
+	if !exists {
+		return nil, notFound("verse not found")
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT a.id, a.user_id, a.created_at, a.updated_at, a.title, a.description,
+		CASE WHEN a.user_id = $1 THEN 'owner' ELSE m.role END
+		FROM analyses a
+		LEFT JOIN analysis_members m ON m.analysis_id = a.id AND m.user_id = $1
+		WHERE (a.user_id = $1 OR m.user_id IS NOT NULL) AND a.deleted_at IS NULL
+		AND EXISTS (
+			SELECT 1 FROM analysis_passages p
+			WHERE p.analysis_id = a.id AND $2 BETWEEN p.start_verse_id AND p.end_verse_id
+		)
+		ORDER BY a.updated_at DESC`,
+		userID, verseID,
+	)
+	if err != nil {
+		slog.Error("Failed to get analyses for verse", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	analyses := []Analysis{}
+	ids := []int{}
+	for rows.Next() {
+		var analysis Analysis
+		err := rows.Scan(&analysis.ID,
+			&analysis.UserID,
+			&analysis.CreatedAt,
+			&analysis.UpdatedAt,
+			&analysis.Title,
+			&analysis.Description,
+			&analysis.Role)
+		if err != nil {
+			slog.Error("Failed to scan analysis", "error", err)
+			return nil, err
+		}
+		analyses = append(analyses, analysis)
+		ids = append(ids, analysis.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	passages, err := getPassages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range analyses {
+		analyses[i].Passages = passages[analyses[i].ID]
+	}
+
+	return analyses, nil
+}
+
+// getPassages loads the passages of the given analyses with their references.
+func getPassages(ctx context.Context, analysisIDs []int) (map[int][]PassageRange, error) {
+	passages := make(map[int][]PassageRange)
+	if len(analysisIDs) == 0 {
+		return passages, nil
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT p.analysis_id, p.start_verse_id, p.end_verse_id,
+		sb.title, sc.number, sv.number, eb.title, ec.number, ev.number
+		FROM analysis_passages p
+		JOIN verses sv ON sv.id = p.start_verse_id
+		JOIN chapters sc ON sc.id = sv.chapter_id
+		JOIN books sb ON sb.id = sc.book_id
+		JOIN verses ev ON ev.id = p.end_verse_id
+		JOIN chapters ec ON ec.id = ev.chapter_id
+		JOIN books eb ON eb.id = ec.book_id
+		WHERE p.analysis_id = ANY($1)
+		ORDER BY p.analysis_id, p.start_verse_id`,
+		pq.Array(analysisIDs),
+	)
+	if err != nil {
+		slog.Error("Failed to get analysis passages", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var analysisID int
+		var passage PassageRange
+		var start, end verseReference
+		err := rows.Scan(&analysisID, &passage.StartVerseID, &passage.EndVerseID,
+			&start.book, &start.chapter, &start.verse, &end.book, &end.chapter, &end.verse)
+		if err != nil {
+			slog.Error("Failed to scan analysis passage", "error", err)
+			return nil, err
+		}
+		passage.Reference = formatReference(start, end)
+		passages[analysisID] = append(passages[analysisID], passage)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	return passages, nil
+}
+
+type verseReference struct {
+	book    string
+	chapter int
+	verse   int
+}
+
+// formatReference writes a range the usual way: "John 1:1", "John 1:1-5",
+// "John 1:50-2:3" or "John 21:25-Acts 1:2".
+func formatReference(start, end verseReference) string {
+	ref := fmt.Sprintf("%s %d:%d", start.book, start.chapter, start.verse)
+	switch {
+	case start == end:
+		return ref
+	case start.book != end.book:
+		return fmt.Sprintf("%s-%s %d:%d", ref, end.book, end.chapter, end.verse)
+	case start.chapter != end.chapter:
+		return fmt.Sprintf("%s-%d:%d", ref, end.chapter, end.verse)
+	default:
+		return fmt.Sprintf("%s-%d", ref, end.verse)
+	}
+}
+
+// setPassages replaces the passages of an analysis and marks them as known,
+// even when there are none, so the backfill leaves the analysis alone.
+func setPassages(ctx context.Context, db passageExecer, analysisID int, passages []PassageRange) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM analysis_passages WHERE analysis_id = $1`, analysisID); err != nil {
+		return fmt.Errorf("error clearing analysis passages: %w", err)
+	}
+
+	for _, passage := range passages {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO analysis_passages (analysis_id, start_verse_id, end_verse_id) VALUES ($1, $2, $3)`,
+			analysisID, passage.StartVerseID, passage.EndVerseID,
+		)
+		if err != nil {
+			if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" {
+				return invalid("passage refers to a verse that does not exist")
+			}
+			return fmt.Errorf("error inserting analysis passage: %w", err)
+		}
+	}
+
+	_, err := db.ExecContext(ctx, `UPDATE analyses SET passages_backfilled = TRUE WHERE id = $1`, analysisID)
+	if err != nil {
+		return fmt.Errorf("error marking analysis passages: %w", err)
+	}
+
+	return nil
+}
+
+func validatePassages(passages []PassageRange) error {
+	if len(passages) > maxPassagesPerAnalysis {
+		return invalid("an analysis can have at most %d passages", maxPassagesPerAnalysis)
+	}
+
+	for _, passage := range passages {
+		if passage.StartVerseID <= 0 || passage.EndVerseID <= 0 {
+			return invalid("passages need a startVerseId and endVerseId")
+		}
+		if passage.StartVerseID > passage.EndVerseID {
+			return invalid("a passage must not end before it starts")
+		}
+	}
+
+	return nil
+}
+
+// derivePassages works out which verses an analysis covers from its details.
+// Words created from the corpus carry a corpusWordId, which pins them to a
+// verse. Older analyses only have the editor's own word numbering, so for those
+// the "[N]" verse markers are combined with a "<Book> <chapter>" title, which is
+// what the editor titles an analysis created from a passage. Anything else is
+// left without passages.
+func derivePassages(ctx context.Context, title string, details map[string]interface{}) ([]PassageRange, error) {
+	var corpusWordIDs []int
+	var verseNumbers []int
+
+	sections, _ := details["sections"].([]interface{})
+	for _, section := range sections {
+		fields, _ := section.(map[string]interface{})
+		words, _ := fields["words"].([]interface{})
+		for _, word := range words {
+			wordFields, _ := word.(map[string]interface{})
+			if id, ok := wordFields["corpusWordId"].(float64); ok && id > 0 {
+				corpusWordIDs = append(corpusWordIDs, int(id))
+				continue
+			}
+			text, _ := wordFields["text"].(string)
+			if match := verseMarker.FindStringSubmatch(text); match != nil {
+				number, _ := strconv.Atoi(match[1])
+				verseNumbers = append(verseNumbers, number)
+			}
+		}
+	}
+
+	var verseIDs []int
+	var err error
+	switch {
+	case len(corpusWordIDs) > 0:
+		verseIDs, err = queryVerseIDs(ctx,
+			`SELECT DISTINCT verse_id FROM words WHERE id = ANY($1)`,
+			pq.Array(corpusWordIDs),
+		)
+	case len(verseNumbers) > 0:
+		book, chapter, ok := parseChapterTitle(title)
+		if !ok {
+			return nil, nil
+		}
+		verseIDs, err = queryVerseIDs(ctx,
+			`SELECT v.id FROM verses v
+			JOIN chapters c ON c.id = v.chapter_id
+			JOIN books b ON b.id = c.book_id
+			WHERE lower(b.title) = lower($1) AND c.number = $2 AND v.number = ANY($3)`,
+			book, chapter, pq.Array(verseNumbers),
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return groupVerseRanges(verseIDs), nil
+}
+
+func queryVerseIDs(ctx context.Context, query string, args ...interface{}) ([]int, error) {
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying verses: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning verse id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// parseChapterTitle splits a title such as "1 John 3" into book and chapter.
+func parseChapterTitle(title string) (string, int, bool) {
+	title = strings.TrimSpace(title)
+	i := strings.LastIndex(title, " ")
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	chapter, err := strconv.Atoi(title[i+1:])
+	if err != nil || chapter <= 0 {
+		return "", 0, false
+	}
+
+	return strings.TrimSpace(title[:i]), chapter, true
+}
+
+// groupVerseRanges collapses verse IDs into ranges of consecutive verses.
+func groupVerseRanges(verseIDs []int) []PassageRange {
+	if len(verseIDs) == 0 {
+		return nil
+	}
+
+	ids := append([]int(nil), verseIDs...)
+	sort.Ints(ids)
+
+	ranges := []PassageRange{{StartVerseID: ids[0], EndVerseID: ids[0]}}
+	for _, id := range ids[1:] {
+		last := &ranges[len(ranges)-1]
+		switch {
+		case id == last.EndVerseID:
+		case id == last.EndVerseID+1:
+			last.EndVerseID = id
+		default:
+			ranges = append(ranges, PassageRange{StartVerseID: id, EndVerseID: id})
+		}
+	}
+
+	return ranges
+}
+
+// BackfillAnalysisPassages derives passages for analyses saved before passages
+// were recorded. Each analysis is looked at once, whether or not any passages
+// can be derived for it.
+func BackfillAnalysisPassages(ctx context.Context) (int, error) {
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, coalesce(title, ''), details FROM analyses WHERE NOT passages_backfilled`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error querying analyses to backfill: %w", err)
+	}
+
+	type pending struct {
+		id      int
+		title   string
+		details map[string]interface{}
+	}
+	var analyses []pending
+	for rows.Next() {
+		var analysis pending
+		var detailsJSON []byte
+		if err := rows.Scan(&analysis.id, &analysis.title, &detailsJSON); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning analysis: %w", err)
+		}
+		// Details that do not decode simply yield no passages.
+		json.Unmarshal(detailsJSON, &analysis.details)
+		analyses = append(analyses, analysis)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating over analyses to backfill: %w", err)
+	}
+
+	backfilled := 0
+	for _, analysis := range analyses {
+		passages, err := derivePassages(ctx, analysis.title, analysis.details)
+		if err != nil {
+			slog.Error("Failed to derive analysis passages", "analysisID", analysis.id, "error", err)
+			continue
+		}
+		if err := backfillPassages(ctx, analysis.id, passages); err != nil {
+			slog.Error("Failed to backfill analysis passages", "analysisID", analysis.id, "error", err)
+			continue
+		}
+		if len(passages) > 0 {
+			backfilled++
+		}
+	}
+
+	return backfilled, nil
+}
+
+func backfillPassages(ctx context.Context, analysisID int, passages []PassageRange) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setPassages(ctx, tx, analysisID, passages); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+)
+
+const (
+	ParsingLabelsAbbreviated = "abbreviated"
+	ParsingLabelsFull        = "full"
+
+	minGreekFontSize = 12
+	maxGreekFontSize = 48
+)
+
+// Allowed preference values. The layout presets are the editor's split
+// layouts; an empty preset keeps the default split.
+var (
+	preferenceParsingLabels = []string{ParsingLabelsAbbreviated, ParsingLabelsFull}
+	preferenceLayoutPresets = []string{"", "greek", "equal", "translation"}
+)
+
+// Preferences are a user's study settings, shared by all their devices.
+// Exports honor the parsing labels and font size, and the editor opens new
+// analyses with the layout preset.
+type Preferences struct {
+	ParsingLabels string `json:"parsingLabels"`
+	// GreekFontSize is in CSS pixels.
+	GreekFontSize int        `json:"greekFontSize"`
+	LayoutPreset  string     `json:"layoutPreset"`
+	UpdatedAt     *time.Time `json:"updatedAt,omitempty"`
+}
+
+// DefaultPreferences are the preferences of a user who never changed them.
+func DefaultPreferences() Preferences {
+	return Preferences{
+		ParsingLabels: ParsingLabelsAbbreviated,
+		GreekFontSize: 20,
+	}
+}
+
+// GetPreferences returns the user's preferences, with defaults for anything
+// they have not set.
+func GetPreferences(ctx context.Context, userID int) (Preferences, error) {
+	defer metrics.ObserveQuery("GetPreferences", time.Now())
+
+	preferences := DefaultPreferences()
+
+	var stored []byte
+	var updatedAt time.Time
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT preferences, updated_at FROM user_preferences WHERE user_id = $1`,
+		userID,
+	).Scan(&stored, &updatedAt)
+	if err == sql.ErrNoRows {
+		return preferences, nil
+	}
+	if err != nil {
+		slog.Error("Failed to get preferences", "error", err)
+		return preferences, err
+	}
+
+	// Stored preferences only override the defaults, so settings added later
+	// start out at their default.
+	if err := json.Unmarshal(stored, &preferences); err != nil {
+		slog.Error("Failed to decode preferences", "userID", userID, "error", err)
+		return DefaultPreferences(), nil
+	}
+	// Layout presets used to be free text; one the editor does not know
+	// falls back to the default split.
+	if !slices.Contains(preferenceLayoutPresets, preferences.LayoutPreset) {
+		preferences.LayoutPreset = ""
+	}
+	preferences.UpdatedAt = &updatedAt
+
+	return preferences, nil
+}
+
+// UpdatePreferences applies a partial JSON update to the user's preferences
+// and returns the result. Unknown fields and invalid values are rejected.
+func UpdatePreferences(ctx context.Context, userID int, patch []byte) (Preferences, error) {
+	defer metrics.ObserveQuery("UpdatePreferences", time.Now())
+
+	preferences, err := GetPreferences(ctx, userID)
+	if err != nil {
+		return preferences, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&preferences); err != nil {
+		return preferences, invalid("invalid preferences: %v", err)
+	}
+
+	preferences.LayoutPreset = strings.TrimSpace(preferences.LayoutPreset)
+	if err := validatePreferences(preferences); err != nil {
+		return preferences, err
+	}
+
+	preferences.UpdatedAt = nil
+	stored, err := json.Marshal(preferences)
+	if err != nil {
+		return preferences, err
+	}
+
+	var updatedAt time.Time
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO user_preferences (user_id, preferences, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			preferences = EXCLUDED.preferences,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at`,
+		userID, stored,
+	).Scan(&updatedAt)
+	if err != nil {
+		slog.Error("Failed to save preferences", "error", err)
+		return preferences, err
+	}
+	preferences.UpdatedAt = &updatedAt
+
+	return preferences, nil
+}
+
+func validatePreferences(p Preferences) error {
+	choices := []struct {
+		name    string
+		value   string
+		allowed []string
+	}{
+		{"parsingLabels", p.ParsingLabels, preferenceParsingLabels},
+	}
+	for _, choice := range choices {
+		if !slices.Contains(choice.allowed, choice.value) {
+			return invalid("%s must be one of: %s", choice.name, strings.Join(choice.allowed, ", "))
+		}
+	}
+
+	if !slices.Contains(preferenceLayoutPresets, p.LayoutPreset) {
+		return invalid("layoutPreset must be empty or one of: %s", strings.Join(preferenceLayoutPresets[1:], ", "))
+	}
+	if p.GreekFontSize < minGreekFontSize || p.GreekFontSize > maxGreekFontSize {
+		return invalid("greekFontSize must be between %d and %d", minGreekFontSize, maxGreekFontSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+)
+
+// AnalysisQuery filters and orders a user's analyses. Page is the opaque
+// cursor returned as NextPage by the previous call.
+type AnalysisQuery struct {
+	Q        string
+	Tag      string
+	FolderID *int
+	BookID   *int
+	Sort     string
+	Page     string
+	Limit    int
+}
+
+type AnalysisPage struct {
+	Items    []Analysis `json:"items"`
+	NextPage string     `json:"nextPage,omitempty"`
+}
+
+// searchSort describes one sort order: the key it orders by and the direction.
+// Pagination is keyset based on (key, id), so the key is also what the cursor
+// carries; validKey checks a key from a cursor before it is cast to cast.
+type searchSort struct {
+	key      string
+	cast     string
+	desc     bool
+	validKey func(string) bool
+}
+
+var searchSorts = map[string]searchSort{
+	"updated":   {key: "a.updated_at", cast: "timestamptz", desc: true, validKey: isTimestampKey},
+	"created":   {key: "a.created_at", cast: "timestamptz", desc: true, validKey: isTimestampKey},
+	"title":     {key: "lower(coalesce(a.title, ''))", cast: "text", desc: false, validKey: isTextKey},
+	"relevance": {key: "ts_rank(a.search_vector, websearch_to_tsquery('simple', $2))", cast: "real", desc: true, validKey: isRealKey},
+}
+
+// timestampKeyLayouts are the forms Postgres writes a timestamptz as text in,
+// with whole-hour and other offsets.
+var timestampKeyLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+}
+
+func isTimestampKey(key string) bool {
+	for _, layout := range timestampKeyLayouts {
+		if _, err := time.Parse(layout, key); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isTextKey(key string) bool {
+	return utf8.ValidString(key) && !strings.ContainsRune(key, 0)
+}
+
+// isRealKey accepts the decimal numbers ts_rank produces. Hex and underscores,
+// which Go accepts but Postgres does not, are rejected.
+func isRealKey(key string) bool {
+	if strings.ContainsAny(key, "_xX") {
+		return false
+	}
+	rank, err := strconv.ParseFloat(key, 32)
+	return err == nil && !math.IsInf(rank, 0) && !math.IsNaN(rank)
+}
+
+// searchCursor is where the next page starts. It records the sort it was made
+// for, since its key means nothing in another order.
+type searchCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   int    `json:"i"`
+}
+
+// SearchAnalyses returns one page of the analyses the user can open, optionally
+// filtered by full-text query, tag, folder and book.
+func SearchAnalyses(ctx context.Context, userID int, query AnalysisQuery) (AnalysisPage, error) {
+	defer metrics.ObserveQuery("SearchAnalyses", time.Now())
+
+	page := AnalysisPage{Items: []Analysis{}}
+
+	sortName := query.Sort
+	if sortName == "" {
+		sortName = "updated"
+		if query.Q != "" {
+			sortName = "relevance"
+		}
+	}
+	order, ok := searchSorts[sortName]
+	if !ok {
+		return page, invalid("sort must be one of: updated, created, title, relevance")
+	}
+	if sortName == "relevance" && query.Q == "" {
+		return page, invalid("sort=relevance requires q")
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	// $1 is always the user and $2 the text query when there is one, which is
+	// what the relevance sort key refers to.
+	args := []interface{}{userID}
+	conditions := []string{"(a.user_id = $1 OR m.user_id IS NOT NULL)", "a.deleted_at IS NULL"}
+
+	if query.Q != "" {
+		args = append(args, query.Q)
+		conditions = append(conditions, "a.search_vector @@ websearch_to_tsquery('simple', $2)")
+	}
+
+	if query.Tag != "" {
+		args = append(args, strings.ToLower(strings.TrimSpace(query.Tag)))
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM analysis_tags t WHERE t.analysis_id = a.id AND t.tag = $%d)", len(args)))
+	}
+
+	if query.FolderID != nil {
+		args = append(args, *query.FolderID)
+		conditions = append(conditions, fmt.Sprintf("uf.folder_id = $%d", len(args)))
+	}
+
+	// A passage touches a book when it overlaps the book's range of verse IDs.
+	if query.BookID != nil {
+		args = append(args, *query.BookID)
+		conditions = append(conditions, fmt.Sprintf(
+			`EXISTS (
+				SELECT 1 FROM analysis_passages p,
+				(SELECT min(v.id) AS first_id, max(v.id) AS last_id
+					FROM verses v JOIN chapters c ON c.id = v.chapter_id
+					WHERE c.book_id = $%d) b
+				WHERE p.analysis_id = a.id AND p.start_verse_id <= b.last_id AND p.end_verse_id >= b.first_id
+			)`, len(args)))
+	}
+
+	direction, comparison := "ASC", ">"
+	if order.desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if query.Page != "" {
+		cursor, err := decodeSearchCursor(query.Page, sortName)
+		if err != nil {
+			return page, err
+		}
+		args = append(args, cursor.Key, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, a.id) %s ($%d::%s, $%d)",
+			order.key, comparison, len(args)-1, order.cast, len(args)))
+	}
+
+	args = append(args, limit+1)
+	sqlQuery := fmt.Sprintf(
+		`SELECT a.id, a.user_id, a.created_at, a.updated_at, a.title, a.description,
+		CASE WHEN a.user_id = $1 THEN 'owner' ELSE m.role END,
+		uf.folder_id,
+		ARRAY(SELECT t.tag FROM analysis_tags t WHERE t.analysis_id = a.id ORDER BY t.tag),
+		(%[1]s)::text
+		FROM analyses a
+		LEFT JOIN analysis_members m ON m.analysis_id = a.id AND m.user_id = $1
+		LEFT JOIN user_analysis_folders uf ON uf.analysis_id = a.id AND uf.user_id = $1
+		WHERE %[2]s
+		ORDER BY %[1]s %[3]s, a.id %[3]s
+		LIMIT $%[4]d`,
+		order.key, strings.Join(conditions, " AND "), direction, len(args),
+	)
+
+	rows, err := database.DB.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		slog.Error("Failed to search analyses", "error", err)
+		return page, err
+	}
+	defer rows.Close()
+
+	var lastKey string
+	for rows.Next() {
+		var analysis Analysis
+		var tags pq.StringArray
+		var key string
+		err := rows.Scan(&analysis.ID,
+			&analysis.UserID,
+			&analysis.CreatedAt,
+			&analysis.UpdatedAt,
+			&analysis.Title,
+			&analysis.Description,
+			&analysis.Role,
+			&analysis.FolderID,
+			&tags,
+			&key)
+		if err != nil {
+			slog.Error("Failed to scan analysis", "error", err)
+			return page, err
+		}
+
+		if len(page.Items) == limit {
+			page.NextPage = encodeSearchCursor(searchCursor{Sort: sortName, Key: lastKey, ID: page.Items[limit-1].ID})
+			break
+		}
+
+		analysis.Tags = tags
+		page.Items = append(page.Items, analysis)
+		lastKey = key
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return page, err
+	}
+
+	return page, nil
+}
+
+func encodeSearchCursor(cursor searchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSearchCursor decodes a cursor for the named sort. Cursors that were
+// tampered with or made for another sort are rejected here rather than
+// failing the query.
+func decodeSearchCursor(page string, sortName string) (searchCursor, error) {
+	var cursor searchCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(page)
+	if err != nil {
+		return cursor, invalid("invalid page cursor")
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, invalid("invalid page cursor")
+	}
+
+	if cursor.Sort != sortName || !searchSorts[sortName].validKey(cursor.Key) {
+		return cursor, invalid("invalid page cursor")
+	}
+
+	return cursor, nil
+}
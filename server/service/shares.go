@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+)
+
+type AnalysisShare struct {
+	ID         int        `json:"id"`
+	AnalysisID int        `json:"analysisId"`
+	Token      string     `json:"token"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt  string     `json:"createdAt"`
+}
+
+// SharedAnalysis is the read-only view of an analysis returned to anyone holding a share token.
+type SharedAnalysis struct {
+	ID          int                    `json:"id"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	CreatedAt   string                 `json:"created_at"`
+	UpdatedAt   string                 `json:"updated_at"`
+}
+
+// CreateAnalysisShare creates a new share link for an analysis owned by the user.
+// A nil expiresAt creates a link that is valid until revoked.
+func CreateAnalysisShare(ctx context.Context, analysisID int, userID int, expiresAt *time.Time) (AnalysisShare, error) {
+	defer metrics.ObserveQuery("CreateAnalysisShare", time.Now())
+
+	var share AnalysisShare
+
+	if err := requireAnalysisManager(ctx, analysisID, userID, "only owners can share this analysis"); err != nil {
+		return share, err
+	}
+
+	token, err := generateShareToken()
+	if err != nil {
+		slog.Error("Failed to generate share token", "error", err)
+		return share, err
+	}
+
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO analysis_shares (analysis_id, token, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, analysis_id, token, expires_at, created_at`,
+		analysisID, token, expiresAt,
+	).Scan(&share.ID, &share.AnalysisID, &share.Token, &share.ExpiresAt, &share.CreatedAt)
+	if err != nil {
+		slog.Error("Failed to insert analysis share", "error", err)
+		return share, err
+	}
+
+	return share, nil
+}
+
+// GetAnalysisShares lists the share links of an analysis owned by the user.
+func GetAnalysisShares(ctx context.Context, analysisID int, userID int) ([]AnalysisShare, error) {
+	defer metrics.ObserveQuery("GetAnalysisShares", time.Now())
+
+	if err := requireAnalysisManager(ctx, analysisID, userID, "only owners can see the share links of this analysis"); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, analysis_id, token, expires_at, created_at
+		FROM analysis_shares
+		WHERE analysis_id = $1
+		ORDER BY created_at DESC`,
+		analysisID,
+	)
+	if err != nil {
+		slog.Error("Failed to get analysis shares", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []AnalysisShare{}
+	for rows.Next() {
+		var share AnalysisShare
+		err := rows.Scan(&share.ID, &share.AnalysisID, &share.Token, &share.ExpiresAt, &share.CreatedAt)
+		if err != nil {
+			slog.Error("Failed to scan analysis share", "error", err)
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// DeleteAnalysisShare revokes a share link of an analysis owned by the user.
+func DeleteAnalysisShare(ctx context.Context, shareID int, analysisID int, userID int) error {
+	defer metrics.ObserveQuery("DeleteAnalysisShare", time.Now())
+
+	if err := requireAnalysisManager(ctx, analysisID, userID, "only owners can revoke share links of this analysis"); err != nil {
+		return err
+	}
+
+	result, err := database.DB.ExecContext(ctx,
+		`DELETE FROM analysis_shares
+		WHERE id = $1 AND analysis_id = $2`,
+		shareID, analysisID,
+	)
+	if err != nil {
+		slog.Error("Failed to delete analysis share", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to get rows affected", "error", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return notFound("no share found with the given id for this user")
+	}
+
+	return nil
+}
+
+// GetSharedAnalysis returns the analysis behind a share token, if the link has not expired.
+func GetSharedAnalysis(ctx context.Context, token string) (SharedAnalysis, error) {
+	defer metrics.ObserveQuery("GetSharedAnalysis", time.Now())
+
+	var analysis SharedAnalysis
+	var detailsJSON []byte
+
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT a.id, a.details, a.created_at, a.updated_at, a.title, a.description
+		FROM analysis_shares s
+		JOIN analyses a ON a.id = s.analysis_id
+		WHERE s.token = $1 AND a.deleted_at IS NULL
+		AND (s.expires_at IS NULL OR s.expires_at > NOW())`,
+		token,
+	).Scan(
+		&analysis.ID,
+		&detailsJSON,
+		&analysis.CreatedAt,
+		&analysis.UpdatedAt,
+		&analysis.Title,
+		&analysis.Description)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return analysis, notFound("shared analysis not found")
+		}
+		slog.Error("Failed to get shared analysis", "error", err)
+		return analysis, err
+	}
+
+	analysis.Details = make(map[string]interface{})
+	if err := json.Unmarshal(detailsJSON, &analysis.Details); err != nil {
+		slog.Error("Failed to unmarshal details", "error", err)
+		return analysis, err
+	}
+
+	return analysis, nil
+}
+
+func generateShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
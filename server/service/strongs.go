@@ -1,10 +1,14 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
 )
 
 type StrongsWord struct {
@@ -18,13 +22,19 @@ type StrongsDefinition struct {
 	Definition string `json:"definition"`
 }
 
-func GetStrongsWord(code string) (StrongsWord, error) {
+func GetStrongsWord(ctx context.Context, code string) (StrongsWord, error) {
+	defer metrics.ObserveQuery("GetStrongsWord", time.Now())
+
 	var strongsWord StrongsWord
 	var definitionsJSON []byte
 
-	row := database.DB.QueryRow("SELECT code, lemma, definitions FROM strongs WHERE code = $1", code)
+	row := database.DB.QueryRowContext(ctx, "SELECT code, lemma, definitions FROM strongs WHERE code = $1", code)
 
 	err := row.Scan(&strongsWord.Strong, &strongsWord.Lemma, &definitionsJSON)
+	if err == sql.ErrNoRows {
+		metrics.LexiconMiss()
+		return StrongsWord{}, notFound("no Strong's entry for %s", code)
+	}
 	if err != nil {
 		return StrongsWord{}, fmt.Errorf("error querying strongs data for code %s: %w", code, err)
 	}
@@ -37,13 +47,15 @@ func GetStrongsWord(code string) (StrongsWord, error) {
 	return strongsWord, nil
 }
 
-func GetStrongsWordByText(text string) (StrongsWord, error) {
+func GetStrongsWordByText(ctx context.Context, text string) (StrongsWord, error) {
+	defer metrics.ObserveQuery("GetStrongsWordByText", time.Now())
+
 	var strongCode string
 	var lemma string
 	var definitionsJSON []byte
 
 	// Join words and strongs tables to get the strongs code and definitions by word text
-	row := database.DB.QueryRow(`
+	row := database.DB.QueryRowContext(ctx, `
 		SELECT s.code, s.lemma, s.definitions
 		FROM words w
 		JOIN strongs s ON w.strong = s.code
@@ -52,6 +64,9 @@ func GetStrongsWordByText(text string) (StrongsWord, error) {
 	`, text)
 
 	err := row.Scan(&strongCode, &lemma, &definitionsJSON)
+	if err == sql.ErrNoRows {
+		return StrongsWord{}, notFound("no Strong's entry for %s", text)
+	}
 	if err != nil {
 		return StrongsWord{}, fmt.Errorf("error querying strongs data for word text '%s': %w", text, err)
 	}
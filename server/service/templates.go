@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+)
+
+const maxTemplateNameLength = 100
+
+// PhraseType is one entry of the phrase palette, as in the editor.
+type PhraseType struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// TemplateSettings is what a template carries over to new analyses: the
+// layout settings and the phrase palette, but no text.
+type TemplateSettings struct {
+	LineSpacing     float64      `json:"lineSpacing"`
+	ShowTranslation bool         `json:"showTranslation"`
+	SplitPosition   float64      `json:"splitPosition"`
+	PhraseTypes     []PhraseType `json:"phraseTypes"`
+}
+
+// AnalysisTemplate is a saved setup. Templates without a UserID are shared
+// with every user and can only be published by teachers and administrators.
+type AnalysisTemplate struct {
+	ID               int              `json:"id"`
+	UserID           *int             `json:"userId"`
+	Name             string           `json:"name"`
+	Settings         TemplateSettings `json:"settings"`
+	SourceAnalysisID *int             `json:"sourceAnalysisId,omitempty"`
+	CreatedAt        string           `json:"createdAt"`
+}
+
+// GetTemplates lists the user's own templates followed by the shared ones.
+func GetTemplates(ctx context.Context, userID int) ([]AnalysisTemplate, error) {
+	defer metrics.ObserveQuery("GetTemplates", time.Now())
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, user_id, name, settings, source_analysis_id, created_at
+		FROM analysis_templates
+		WHERE user_id = $1 OR user_id IS NULL
+		ORDER BY user_id IS NULL, lower(name)`,
+		userID,
+	)
+	if err != nil {
+		slog.Error("Failed to get templates", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []AnalysisTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			slog.Error("Failed to scan template", "error", err)
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// GetTemplate returns a template the user can use.
+func GetTemplate(ctx context.Context, templateID int, userID int) (AnalysisTemplate, error) {
+	defer metrics.ObserveQuery("GetTemplate", time.Now())
+
+	row := database.DB.QueryRowContext(ctx,
+		`SELECT id, user_id, name, settings, source_analysis_id, created_at
+		FROM analysis_templates
+		WHERE id = $1 AND (user_id = $2 OR user_id IS NULL)`,
+		templateID, userID,
+	)
+
+	template, err := scanTemplate(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return template, notFound("template not found")
+		}
+		slog.Error("Failed to get template", "error", err)
+		return template, err
+	}
+
+	return template, nil
+}
+
+// CreateTemplate saves the settings and phrase palette of an analysis the user
+// can open as one of the user's templates.
+func CreateTemplate(ctx context.Context, userID int, analysisID int, name string) (AnalysisTemplate, error) {
+	analysis, err := GetAnalysisById(ctx, analysisID, userID)
+	if err != nil {
+		return AnalysisTemplate{}, err
+	}
+
+	return insertTemplate(ctx, &userID, analysis, name)
+}
+
+// PublishTemplate saves the settings and phrase palette of an analysis the user
+// can open as a template shared with all users, so that a teacher can give a
+// class a common setup. Callers check that the user is a teacher.
+func PublishTemplate(ctx context.Context, userID int, analysisID int, name string) (AnalysisTemplate, error) {
+	analysis, err := GetAnalysisById(ctx, analysisID, userID)
+	if err != nil {
+		return AnalysisTemplate{}, err
+	}
+
+	return insertTemplate(ctx, nil, analysis, name)
+}
+
+// CreateSharedTemplate saves the settings of any analysis as a template shared
+// with all users. It is meant for administrators.
+func CreateSharedTemplate(ctx context.Context, analysisID int, name string) (AnalysisTemplate, error) {
+	defer metrics.ObserveQuery("CreateSharedTemplate", time.Now())
+
+	var ownerID int
+	err := database.DB.QueryRowContext(ctx, `SELECT user_id FROM analyses WHERE id = $1`, analysisID).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AnalysisTemplate{}, notFound("analysis not found")
+		}
+		return AnalysisTemplate{}, err
+	}
+
+	analysis, err := GetAnalysisById(ctx, analysisID, ownerID)
+	if err != nil {
+		return AnalysisTemplate{}, err
+	}
+
+	return insertTemplate(ctx, nil, analysis, name)
+}
+
+func insertTemplate(ctx context.Context, userID *int, analysis Analysis, name string) (AnalysisTemplate, error) {
+	template := AnalysisTemplate{
+		UserID:           userID,
+		Name:             strings.TrimSpace(name),
+		Settings:         templateSettingsFromDetails(analysis.Details),
+		SourceAnalysisID: &analysis.ID,
+	}
+	if template.Name == "" {
+		return template, invalid("template name is required")
+	}
+	if len([]rune(template.Name)) > maxTemplateNameLength {
+		return template, invalid("template name is too long")
+	}
+
+	settingsJSON, err := json.Marshal(template.Settings)
+	if err != nil {
+		return template, err
+	}
+
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO analysis_templates (user_id, name, settings, source_analysis_id)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		userID, template.Name, settingsJSON, analysis.ID,
+	).Scan(&template.ID, &template.CreatedAt)
+	if err != nil {
+		slog.Error("Failed to insert template", "error", err)
+		return template, err
+	}
+
+	return template, nil
+}
+
+// DeleteTemplate deletes one of the user's own templates. Analyses created
+// from it keep their content.
+func DeleteTemplate(ctx context.Context, templateID int, userID int) error {
+	defer metrics.ObserveQuery("DeleteTemplate", time.Now())
+
+	result, err := database.DB.ExecContext(ctx,
+		`DELETE FROM analysis_templates WHERE id = $1 AND user_id = $2`,
+		templateID, userID,
+	)
+	if err != nil {
+		slog.Error("Failed to delete template", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result, "no template found with the given id for this user")
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTemplate(row rowScanner) (AnalysisTemplate, error) {
+	var template AnalysisTemplate
+	var userID, sourceID sql.NullInt64
+	var settingsJSON []byte
+
+	err := row.Scan(&template.ID, &userID, &template.Name, &settingsJSON, &sourceID, &template.CreatedAt)
+	if err != nil {
+		return template, err
+	}
+
+	if userID.Valid {
+		id := int(userID.Int64)
+		template.UserID = &id
+	}
+	if sourceID.Valid {
+		id := int(sourceID.Int64)
+		template.SourceAnalysisID = &id
+	}
+
+	if err := json.Unmarshal(settingsJSON, &template.Settings); err != nil {
+		return template, err
+	}
+
+	return template, nil
+}
+
+// templateSettingsFromDetails collects the layout settings and the phrase
+// types used by an analysis. A palette saved in the details by an earlier
+// template is kept even where no phrase uses it yet.
+func templateSettingsFromDetails(details map[string]interface{}) TemplateSettings {
+	settings := TemplateSettings{
+		LineSpacing:   DefaultLineSpacing,
+		SplitPosition: DefaultSplitPosition,
+		PhraseTypes:   []PhraseType{},
+	}
+
+	if value, ok := details["lineSpacing"].(float64); ok && value > 0 {
+		settings.LineSpacing = value
+	}
+	if value, ok := details["splitPosition"].(float64); ok && value > 0 && value < 100 {
+		settings.SplitPosition = value
+	}
+	if value, ok := details["showTranslation"].(bool); ok {
+		settings.ShowTranslation = value
+	}
+
+	seen := make(map[string]bool)
+	addPhraseType := func(phraseType PhraseType) {
+		if phraseType.ID == "" || seen[phraseType.ID] {
+			return
+		}
+		if phraseType.Name == "" {
+			phraseType.Name = phraseType.ID
+		}
+		seen[phraseType.ID] = true
+		settings.PhraseTypes = append(settings.PhraseTypes, phraseType)
+	}
+
+	palette, _ := details["phraseTypes"].([]interface{})
+	for _, entry := range palette {
+		fields, _ := entry.(map[string]interface{})
+		id, _ := fields["id"].(string)
+		name, _ := fields["name"].(string)
+		color, _ := fields["color"].(string)
+		addPhraseType(PhraseType{ID: id, Name: name, Color: color})
+	}
+
+	sections, _ := details["sections"].([]interface{})
+	for _, section := range sections {
+		fields, _ := section.(map[string]interface{})
+		phrases, _ := fields["phrases"].([]interface{})
+		for _, phrase := range phrases {
+			phraseFields, _ := phrase.(map[string]interface{})
+			phraseType, _ := phraseFields["type"].(string)
+			color, _ := phraseFields["color"].(string)
+			addPhraseType(PhraseType{ID: phraseType, Color: color})
+		}
+	}
+
+	return settings
+}
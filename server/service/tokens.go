@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+	"github.com/lib/pq"
+)
+
+// Scopes a personal access token can be granted.
+const (
+	ScopeReadCorpus    = "read:corpus"
+	ScopeReadAnalyses  = "read:analyses"
+	ScopeWriteAnalyses = "write:analyses"
+)
+
+// AccessTokenPrefix starts every personal access token, which tells them apart
+// from JWTs.
+const AccessTokenPrefix = "gst_"
+
+// ErrAccessTokenRejected is returned for access tokens that do not exist, have
+// expired or were revoked.
+var ErrAccessTokenRejected = errors.New("invalid or expired access token")
+
+const (
+	maxAccessTokens     = 50
+	maxAccessTokenName  = 100
+	maxAccessTokenDays  = 365
+	defaultTokenDays    = 30
+	lastUsedGranularity = time.Minute
+)
+
+var accessTokenScopes = map[string]bool{
+	ScopeReadCorpus:    true,
+	ScopeReadAnalyses:  true,
+	ScopeWriteAnalyses: true,
+}
+
+// PersonalAccessToken describes a token without its secret, which is only
+// returned once, when the token is created.
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreateAccessToken creates a token for the user that expires after the given
+// number of days (30 when zero) and returns it along with its secret.
+func CreateAccessToken(ctx context.Context, userID int, name string, scopes []string, expiresInDays int) (PersonalAccessToken, string, error) {
+	defer metrics.ObserveQuery("CreateAccessToken", time.Now())
+
+	var token PersonalAccessToken
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAccessTokenName {
+		return token, "", invalid("name must be between 1 and %d characters", maxAccessTokenName)
+	}
+
+	if len(scopes) == 0 {
+		return token, "", invalid("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !accessTokenScopes[scope] {
+			return token, "", invalid("unknown scope %q", scope)
+		}
+	}
+
+	if expiresInDays == 0 {
+		expiresInDays = defaultTokenDays
+	}
+	if expiresInDays < 1 || expiresInDays > maxAccessTokenDays {
+		return token, "", invalid("expiresInDays must be between 1 and %d", maxAccessTokenDays)
+	}
+
+	var count int
+	err := database.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM personal_access_tokens WHERE user_id = $1`, userID).Scan(&count)
+	if err != nil {
+		slog.Error("Failed to count access tokens", "error", err)
+		return token, "", err
+	}
+	if count >= maxAccessTokens {
+		return token, "", invalid("a user can have at most %d access tokens", maxAccessTokens)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		slog.Error("Failed to generate access token", "error", err)
+		return token, "", err
+	}
+	secret := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO personal_access_tokens (user_id, name, token_hash, prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, name, prefix, scopes, expires_at, last_used_at, created_at`,
+		userID, name, hashAccessToken(secret), secret[:len(AccessTokenPrefix)+6], pq.Array(scopes),
+		time.Now().AddDate(0, 0, expiresInDays),
+	).Scan(&token.ID, &token.Name, &token.Prefix, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+	if err != nil {
+		slog.Error("Failed to insert access token", "error", err)
+		return token, "", err
+	}
+
+	return token, secret, nil
+}
+
+// GetAccessTokens lists the user's tokens, newest first.
+func GetAccessTokens(ctx context.Context, userID int) ([]PersonalAccessToken, error) {
+	defer metrics.ObserveQuery("GetAccessTokens", time.Now())
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		slog.Error("Failed to get access tokens", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		var token PersonalAccessToken
+		err := rows.Scan(&token.ID, &token.Name, &token.Prefix, pq.Array(&token.Scopes),
+			&token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+		if err != nil {
+			slog.Error("Failed to scan access token", "error", err)
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteAccessToken revokes one of the user's tokens.
+func DeleteAccessToken(ctx context.Context, id int, userID int) error {
+	defer metrics.ObserveQuery("DeleteAccessToken", time.Now())
+
+	result, err := database.DB.ExecContext(ctx,
+		`DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`,
+		id, userID,
+	)
+	if err != nil {
+		slog.Error("Failed to delete access token", "error", err)
+		return err
+	}
+
+	return requireRowsAffected(result, "no access token found with the given id for this user")
+}
+
+// AuthenticateAccessToken returns the user a valid, unexpired token belongs to
+// and the token's scopes, and records that the token was used.
+func AuthenticateAccessToken(ctx context.Context, secret string) (User, []string, error) {
+	defer metrics.ObserveQuery("AuthenticateAccessToken", time.Now())
+
+	var id int
+	var idpID string
+	var scopes []string
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT t.id, u.idp_id, t.scopes
+		FROM personal_access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.expires_at > NOW()`,
+		hashAccessToken(secret),
+	).Scan(&id, &idpID, pq.Array(&scopes))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, nil, ErrAccessTokenRejected
+		}
+		slog.Error("Failed to look up access token", "error", err)
+		return User{}, nil, err
+	}
+
+	// Scripts can make many requests a second; only write when the recorded
+	// time is noticeably out of date.
+	_, err = database.DB.ExecContext(ctx,
+		`UPDATE personal_access_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)`,
+		id, time.Now().Add(-lastUsedGranularity),
+	)
+	if err != nil {
+		slog.Error("Failed to record access token use", "error", err)
+	}
+
+	user, err := ProvisionUser(ctx, User{IdpID: idpID})
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	return user, scopes, nil
+}
+
+func hashAccessToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
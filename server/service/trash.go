@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+)
+
+// DefaultTrashRetention is how long deleted analyses are kept before they are purged.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// GetTrash lists the deleted analyses the user could restore, most recently deleted first.
+func GetTrash(ctx context.Context, userID int) ([]Analysis, error) {
+	defer metrics.ObserveQuery("GetTrash", time.Now())
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT a.id, a.user_id, a.created_at, a.updated_at, a.title, a.description, a.deleted_at
+		FROM analyses a
+		WHERE a.deleted_at IS NOT NULL AND a.user_id = $1
+		ORDER BY a.deleted_at DESC`,
+		userID,
+	)
+	if err != nil {
+		slog.Error("Failed to get trash", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	analyses := []Analysis{}
+	for rows.Next() {
+		var analysis Analysis
+		err := rows.Scan(&analysis.ID,
+			&analysis.UserID,
+			&analysis.CreatedAt,
+			&analysis.UpdatedAt,
+			&analysis.Title,
+			&analysis.Description,
+			&analysis.DeletedAt)
+		if err != nil {
+			slog.Error("Failed to scan analysis", "error", err)
+			return nil, err
+		}
+		analysis.Role = RoleOwner
+		analyses = append(analyses, analysis)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error iterating through rows", "error", err)
+		return nil, err
+	}
+
+	return analyses, nil
+}
+
+// RestoreAnalysis takes an analysis out of the trash.
+func RestoreAnalysis(ctx context.Context, id int, userID int) error {
+	defer metrics.ObserveQuery("RestoreAnalysis", time.Now())
+
+	result, err := database.DB.ExecContext(ctx,
+		`UPDATE analyses SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND user_id = $2`,
+		id, userID,
+	)
+	if err != nil {
+		slog.Error("Failed to restore analysis", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return deniedOrNotFound(ctx, id, userID, true,
+			"only owners can restore this analysis",
+			"no deleted analysis found with the given id for this user")
+	}
+
+	return nil
+}
+
+// PurgeTrash hard-deletes analyses that have been in the trash for longer than
+// retention and returns how many were removed.
+func PurgeTrash(ctx context.Context, retention time.Duration) (int, error) {
+	defer metrics.ObserveQuery("PurgeTrash", time.Now())
+
+	result, err := database.DB.ExecContext(ctx,
+		`DELETE FROM analyses WHERE deleted_at IS NOT NULL AND deleted_at <= $1`,
+		time.Now().Add(-retention),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error purging trash: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting purged analyses: %w", err)
+	}
+
+	return int(purged), nil
+}
+
+// RunTrashPurger purges expired trash every interval until ctx is cancelled.
+func RunTrashPurger(ctx context.Context, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := PurgeTrash(ctx, retention)
+		if err != nil {
+			slog.Error("Failed to purge trash", "error", err)
+		} else if purged > 0 {
+			slog.Info("Purged trash", "analyses", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,28 +2,51 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"log/slog"
+	"time"
 
 	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
 )
 
 type User struct {
-	ID            int
-	IdpID         string
-	FirstName     string
-	LastName      string
-	Nickname      string
-	Name          string
-	Picture       string
-	Email         string
-	EmailVerified bool
+	ID            int        `json:"id"`
+	IdpID         string     `json:"idpId"`
+	FirstName     string     `json:"firstName"`
+	LastName      string     `json:"lastName"`
+	Nickname      string     `json:"nickname"`
+	Name          string     `json:"name"`
+	Picture       string     `json:"picture"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"emailVerified"`
+	Role          UserRole   `json:"role"`
+	DisabledAt    *time.Time `json:"disabledAt,omitempty"`
+
+	// ProfileRefreshedAt is when the profile fields were last taken from the
+	// identity provider's ID token or userinfo endpoint, or nil if they only
+	// ever came from access token claims.
+	ProfileRefreshedAt *time.Time `json:"-"`
 }
 
-// InsertUser inserts a new user into the database
+// ProfileRefreshInterval is how long a profile from the identity provider is
+// used before it is fetched again.
+const ProfileRefreshInterval = 24 * time.Hour
+
+// ProfileStale reports whether the user's profile should be fetched from the
+// identity provider again.
+func (u User) ProfileStale() bool {
+	return u.ProfileRefreshedAt == nil || time.Since(*u.ProfileRefreshedAt) > ProfileRefreshInterval
+}
+
+// InsertUser inserts a new user into the database, or updates the profile of
+// an existing one. ProfileRefreshedAt is only written when it is set.
 func InsertUser(ctx context.Context, user User) (int64, error) {
+	defer metrics.ObserveQuery("InsertUser", time.Now())
+
 	query := `
-		INSERT INTO users (idp_id, first_name, last_name, nickname, name, picture, email, email_verified)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO users (idp_id, first_name, last_name, nickname, name, picture, email, email_verified, profile_refreshed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		ON CONFLICT (idp_id) DO UPDATE SET
 			first_name = $2,
 			last_name = $3,
@@ -31,7 +54,8 @@ func InsertUser(ctx context.Context, user User) (int64, error) {
 			name = $5,
 			picture = $6,
 			email = $7,
-			email_verified = $8
+			email_verified = $8,
+			profile_refreshed_at = COALESCE($9, users.profile_refreshed_at)
 		RETURNING id
 	`
 
@@ -47,6 +71,7 @@ func InsertUser(ctx context.Context, user User) (int64, error) {
 		user.Picture,
 		user.Email,
 		user.EmailVerified,
+		user.ProfileRefreshedAt,
 	)
 
 	err := row.Scan(&id)
@@ -55,13 +80,16 @@ func InsertUser(ctx context.Context, user User) (int64, error) {
 		return 0, err
 	}
 
+	users.invalidate(user.IdpID)
 	return id, nil
 }
 
 // GetUserByIdpID retrieves a user from the database by their IdP ID
 func GetUserByIdpID(ctx context.Context, idpID string) (User, error) {
+	defer metrics.ObserveQuery("GetUserByIdpID", time.Now())
+
 	query := `
-		SELECT id, idp_id, first_name, last_name, nickname, name, picture, email, email_verified 
+		SELECT id, idp_id, first_name, last_name, nickname, name, picture, email, email_verified, role, disabled_at, profile_refreshed_at
 		FROM users
 		WHERE idp_id = $1
 	`
@@ -79,18 +107,65 @@ func GetUserByIdpID(ctx context.Context, idpID string) (User, error) {
 		&user.Picture,
 		&user.Email,
 		&user.EmailVerified,
+		&user.Role,
+		&user.DisabledAt,
+		&user.ProfileRefreshedAt,
 	)
 
 	if err != nil {
-		slog.Error("Failed to retrieve user by IdP ID", "idpID", idpID, "error", err)
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to retrieve user by IdP ID", "idpID", idpID, "error", err)
+		}
 		return User{}, err
 	}
 
 	return user, nil
 }
 
-// UpdateUserByIdpID updates an existing user in the database by their IdP ID
+// GetUserByID retrieves a user from the database by their internal ID
+func GetUserByID(ctx context.Context, id int) (User, error) {
+	defer metrics.ObserveQuery("GetUserByID", time.Now())
+
+	query := `
+		SELECT id, idp_id, first_name, last_name, nickname, name, picture, email, email_verified, role, disabled_at, profile_refreshed_at
+		FROM users
+		WHERE id = $1
+	`
+
+	var user User
+	row := database.DB.QueryRowContext(ctx, query, id)
+
+	err := row.Scan(
+		&user.ID,
+		&user.IdpID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Nickname,
+		&user.Name,
+		&user.Picture,
+		&user.Email,
+		&user.EmailVerified,
+		&user.Role,
+		&user.DisabledAt,
+		&user.ProfileRefreshedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return User{}, notFound("user not found")
+	}
+	if err != nil {
+		slog.Error("Failed to retrieve user by ID", "id", id, "error", err)
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateUserByIdpID updates an existing user's profile, fetched from the
+// identity provider, by their IdP ID
 func UpdateUserByIdpID(ctx context.Context, user User) error {
+	defer metrics.ObserveQuery("UpdateUserByIdpID", time.Now())
+
 	query := `
 		UPDATE users
 		SET 
@@ -100,7 +175,8 @@ func UpdateUserByIdpID(ctx context.Context, user User) error {
 			name = $4,
 			picture = $5,
 			email = $6,
-			email_verified = $7
+			email_verified = $7,
+			profile_refreshed_at = NOW()
 		WHERE idp_id = $8
 	`
 
@@ -122,5 +198,6 @@ func UpdateUserByIdpID(ctx context.Context, user User) error {
 		return err
 	}
 
+	users.invalidate(user.IdpID)
 	return nil
 }
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+const (
+	userCacheSize = 10000
+	userCacheTTL  = 5 * time.Minute
+)
+
+// users caches the user each IdP subject maps to, so authenticated requests do
+// not each need a query to find their user.
+var users = newUserCache(userCacheSize, userCacheTTL)
+
+// userCache is a least-recently-used cache of users by IdP subject whose
+// entries also expire after a fixed time.
+type userCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cachedUser struct {
+	user      User
+	expiresAt time.Time
+}
+
+func newUserCache(size int, ttl time.Duration) *userCache {
+	return &userCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *userCache) get(idpID string) (User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[idpID]
+	if !ok {
+		return User{}, false
+	}
+
+	entry := element.Value.(*cachedUser)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, idpID)
+		return User{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.user, true
+}
+
+func (c *userCache) put(user User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cachedUser{user: user, expiresAt: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[user.IdpID]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[user.IdpID] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedUser).user.IdpID)
+	}
+}
+
+func (c *userCache) invalidate(idpID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[idpID]; ok {
+		c.order.Remove(element)
+		delete(c.entries, idpID)
+	}
+}
+
+// ProvisionUser returns the user for profile.IdpID, creating them from the
+// profile the first time they are seen. An existing user's profile is left as
+// it is, since access tokens often carry less of it than the login did.
+func ProvisionUser(ctx context.Context, profile User) (User, error) {
+	if user, ok := users.get(profile.IdpID); ok {
+		return user, nil
+	}
+
+	user, err := GetUserByIdpID(ctx, profile.IdpID)
+	if err == sql.ErrNoRows {
+		id, err := InsertUser(ctx, profile)
+		if err != nil {
+			return User{}, err
+		}
+		user = profile
+		user.ID = int(id)
+		user.Role = UserRoleUser
+	} else if err != nil {
+		return User{}, err
+	}
+
+	users.put(user)
+	return user, nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ZacharyWM/greek-study-tool/server/database"
+	"github.com/ZacharyWM/greek-study-tool/server/metrics"
+	"github.com/lib/pq"
+)
+
+const (
+	maxOpenTabs           = 20
+	maxLayoutPresetLength = 50
+)
+
+// Workspace is where the user left off: the analysis they last had open, the
+// analyses open as tabs and the editor layout preset.
+type Workspace struct {
+	LastAnalysisID *int    `json:"lastAnalysisId"`
+	OpenTabs       []int   `json:"openTabs"`
+	LayoutPreset   string  `json:"layoutPreset"`
+	UpdatedAt      *string `json:"updatedAt,omitempty"`
+}
+
+// GetWorkspace returns the user's workspace. Analyses the user can no longer
+// open are left out, and the preferred layout is used until the workspace has
+// one of its own.
+func GetWorkspace(ctx context.Context, userID int) (Workspace, error) {
+	defer metrics.ObserveQuery("GetWorkspace", time.Now())
+
+	workspace := Workspace{OpenTabs: []int{}}
+	var tabs pq.Int64Array
+
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT last_analysis_id, open_tabs, layout_preset, updated_at
+		FROM user_workspaces WHERE user_id = $1`,
+		userID,
+	).Scan(&workspace.LastAnalysisID, &tabs, &workspace.LayoutPreset, &workspace.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("Failed to get workspace", "error", err)
+		return workspace, err
+	}
+
+	if workspace.LayoutPreset == "" {
+		preferences, err := GetPreferences(ctx, userID)
+		if err != nil {
+			return workspace, err
+		}
+		workspace.LayoutPreset = preferences.LayoutPreset
+	}
+
+	ids := make([]int, 0, len(tabs)+1)
+	for _, tab := range tabs {
+		ids = append(ids, int(tab))
+	}
+	if workspace.LastAnalysisID != nil {
+		ids = append(ids, *workspace.LastAnalysisID)
+	}
+
+	readable, err := readableAnalyses(ctx, userID, ids)
+	if err != nil {
+		return workspace, err
+	}
+
+	for _, tab := range tabs {
+		if readable[int(tab)] {
+			workspace.OpenTabs = append(workspace.OpenTabs, int(tab))
+		}
+	}
+	if workspace.LastAnalysisID != nil && !readable[*workspace.LastAnalysisID] {
+		workspace.LastAnalysisID = nil
+	}
+
+	return workspace, nil
+}
+
+// SaveWorkspace replaces the user's workspace.
+func SaveWorkspace(ctx context.Context, userID int, workspace Workspace) (Workspace, error) {
+	defer metrics.ObserveQuery("SaveWorkspace", time.Now())
+
+	workspace.LayoutPreset = strings.TrimSpace(workspace.LayoutPreset)
+	if len([]rune(workspace.LayoutPreset)) > maxLayoutPresetLength {
+		return workspace, invalid("layoutPreset is too long")
+	}
+
+	seen := make(map[int]bool)
+	tabs := []int{}
+	for _, tab := range workspace.OpenTabs {
+		if !seen[tab] {
+			seen[tab] = true
+			tabs = append(tabs, tab)
+		}
+	}
+	if len(tabs) > maxOpenTabs {
+		return workspace, invalid("at most %d tabs can be open", maxOpenTabs)
+	}
+	workspace.OpenTabs = tabs
+
+	ids := append([]int(nil), tabs...)
+	if workspace.LastAnalysisID != nil {
+		ids = append(ids, *workspace.LastAnalysisID)
+	}
+
+	readable, err := readableAnalyses(ctx, userID, ids)
+	if err != nil {
+		return workspace, err
+	}
+	for _, id := range ids {
+		if !readable[id] {
+			return workspace, invalid("analysis %d not found", id)
+		}
+	}
+
+	err = database.DB.QueryRowContext(ctx,
+		`INSERT INTO user_workspaces (user_id, last_analysis_id, open_tabs, layout_preset, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			last_analysis_id = EXCLUDED.last_analysis_id,
+			open_tabs = EXCLUDED.open_tabs,
+			layout_preset = EXCLUDED.layout_preset,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at`,
+		userID, workspace.LastAnalysisID, pq.Array(tabs), workspace.LayoutPreset,
+	).Scan(&workspace.UpdatedAt)
+	if err != nil {
+		slog.Error("Failed to save workspace", "error", err)
+		return workspace, err
+	}
+
+	return workspace, nil
+}
+
+// RecordOpenedAnalysis makes the analysis the one the user last had open,
+// leaving the rest of the workspace as it is. Callers have already checked
+// that the user can open it.
+func RecordOpenedAnalysis(ctx context.Context, userID int, analysisID int) error {
+	defer metrics.ObserveQuery("RecordOpenedAnalysis", time.Now())
+
+	_, err := database.DB.ExecContext(ctx,
+		`INSERT INTO user_workspaces (user_id, last_analysis_id, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			last_analysis_id = EXCLUDED.last_analysis_id,
+			updated_at = EXCLUDED.updated_at`,
+		userID, analysisID,
+	)
+	if err != nil {
+		slog.Error("Failed to record opened analysis", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// readableAnalyses reports which of the given analyses the user can open.
+func readableAnalyses(ctx context.Context, userID int, ids []int) (map[int]bool, error) {
+	readable := make(map[int]bool)
+	if len(ids) == 0 {
+		return readable, nil
+	}
+
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT a.id FROM analyses a
+		LEFT JOIN analysis_members m ON m.analysis_id = a.id AND m.user_id = $1
+		WHERE a.id = ANY($2) AND a.deleted_at IS NULL AND (a.user_id = $1 OR m.user_id IS NOT NULL)`,
+		userID, pq.Array(ids),
+	)
+	if err != nil {
+		slog.Error("Failed to check analyses", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			slog.Error("Failed to scan analysis id", "error", err)
+			return nil, err
+		}
+		readable[id] = true
+	}
+
+	return readable, rows.Err()
+}
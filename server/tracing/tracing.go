@@ -0,0 +1,72 @@
+// Package tracing sets up OpenTelemetry tracing.
+//
+// Tracing is off unless TRACING_ENABLED is true. Spans are then exported over
+// OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, and printed to stdout otherwise,
+// which is handy locally. The other standard OTEL_* variables, such as
+// OTEL_SERVICE_NAME and OTEL_TRACES_SAMPLER, are honoured too.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName names this server in traces unless OTEL_SERVICE_NAME is set.
+const ServiceName = "greek-study-tool"
+
+// Init installs the global tracer provider and propagator, and returns a
+// function that flushes buffered spans on shutdown. When tracing is disabled
+// the global no-op provider stays in place, so instrumented code costs little.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv("TRACING_ENABLED") != "true" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace exporter: %w", err)
+	}
+
+	// Later options win, so OTEL_SERVICE_NAME overrides the default name.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		slog.Info("Exporting traces over OTLP")
+		return otlptracehttp.New(ctx)
+	}
+
+	slog.Info("Printing traces to stdout; set OTEL_EXPORTER_OTLP_ENDPOINT to export them")
+	return stdouttrace.New(stdouttrace.WithPrettyPrint())
+}